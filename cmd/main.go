@@ -6,7 +6,6 @@ import (
 	"log"
 	"os/signal"
 	"syscall"
-	"time"
 	"waiterd/internal/config"
 	httpserver "waiterd/internal/server/http"
 	"waiterd/pkg/cfg"
@@ -34,19 +33,23 @@ func main() {
 	}
 	defer cacheCleanup()
 
+	if err := httpserver.SetupClients(conf.Services); err != nil {
+		log.Fatalf("failed to init service clients: %v", err)
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	srv := httpserver.New(conf)
 
-	go func() {
-		if err := srv.Start(ctx); err != nil {
+	done := make(chan error, 1)
+	go func() { done <- srv.Start(ctx) }()
+
+	// Start returns after the signal, once in-flight requests are drained (or shutdown timeout expired)
+	if err := <-done; err != nil {
+		if ctx.Err() == nil {
 			log.Fatalf("server error: %v", err)
 		}
-	}()
-
-	// wait for signal
-	<-ctx.Done()
-	// give some time for graceful shutdown
-	time.Sleep(time.Second)
+		log.Printf("graceful shutdown: %v", err)
+	}
 }
@@ -26,6 +26,38 @@ type Gateway struct {
 	WriteTimeoutSec    int    `yaml:"write_timeout_sec"    env:"GATEWAY_WRITE_TIMEOUT"     env-default:"15"`
 	IdleTimeoutSec     int    `yaml:"idle_timeout_sec"     env:"GATEWAY_IDLE_TIMEOUT"      env-default:"60"`
 	ShutdownTimeoutSec int    `yaml:"shutdown_timeout_sec" env:"GATEWAY_SHUTDOWN_TIMEOUT"  env-default:"15"`
+	// BodyLimit — максимальный размер тела запроса в байтах (и для потоковых, и для chunked); больше — 413.
+	BodyLimit int `yaml:"body_limit" env:"GATEWAY_BODY_LIMIT" env-default:"4194304"`
+	// DeadlineHeader — заголовок с оставшимся бюджетом запроса для upstream (формат grpc-timeout, напр. "1500m").
+	DeadlineHeader string      `yaml:"deadline_header" env:"GATEWAY_DEADLINE_HEADER" env-default:""`
+	TLS            ListenerTLS `yaml:"tls"`
+	Admin          Admin       `yaml:"admin"`
+}
+
+// Admin — служебные маршруты /admin/*; регистрируются, только если задан token.
+type Admin struct {
+	Token string `yaml:"token" env:"GATEWAY_ADMIN_TOKEN" env-default:""`
+}
+
+// ListenerTLS включает HTTPS на адресе шлюза, если задан хотя бы один сертификат.
+type ListenerTLS struct {
+	CertFile     string        `yaml:"cert_file" env:"GATEWAY_TLS_CERT" env-default:""`
+	KeyFile      string        `yaml:"key_file"  env:"GATEWAY_TLS_KEY"  env-default:""`
+	Certificates []CertKeyPair `yaml:"certificates"` // дополнительные сертификаты, выбираются по SNI
+	MinVersion   string        `yaml:"min_version"`  // "1.2" (по умолчанию) или "1.3"
+	CipherSuites []string      `yaml:"cipher_suites"`
+	// ClientAuth: none (по умолчанию), request, verify_if_given, require.
+	ClientAuth      string `yaml:"client_auth"`
+	ClientCAFile    string `yaml:"client_ca_file"`
+	ReloadInterval  string `yaml:"reload_interval"`  // как часто проверять изменения файлов сертификатов, по умолчанию 30s
+	RedirectAddress string `yaml:"redirect_address"` // адрес HTTP-листенера, который редиректит на HTTPS (напр. ":80")
+	// DisableHTTP2 оставляет по ALPN только http/1.1 (по умолчанию листенер предлагает и h2).
+	DisableHTTP2 bool `yaml:"disable_http2" env:"GATEWAY_TLS_DISABLE_HTTP2"`
+}
+
+type CertKeyPair struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
 }
 
 type Cache struct {
@@ -35,6 +67,65 @@ type Cache struct {
 	Db     int    `yaml:"db"        env:"CACHE_DB"        env-default:"0"`
 	Pass   string `yaml:"password"  env:"CACHE_PASSWORD"  env-default:""`
 	TTL    string `yaml:"ttl" env:"CACHE_TTL" env-default:""`
+	// MaxBodyBytes ограничивает размер ответа, который буферизуется ради кэша;
+	// всё, что больше, проксируется потоком и не кэшируется.
+	MaxBodyBytes int64 `yaml:"max_body_bytes" env:"CACHE_MAX_BODY_BYTES" env-default:"1048576"`
+	// CoalesceTimeout — сколько одинаковые запросы ждут, пока первый заполнит кэш; "0" отключает склейку.
+	CoalesceTimeout string `yaml:"coalesce_timeout" env:"CACHE_COALESCE_TIMEOUT" env-default:"5s"`
+	// Mode — режим кэширования proxy-endpoint по умолчанию: ttl или http (см. Endpoint.CacheMode).
+	Mode string `yaml:"mode" env:"CACHE_MODE" env-default:"ttl"`
+	// Лимиты driver: memory (и L1 у tiered) — при превышении вытесняются давно не использованные записи (LRU); 0 — без лимита.
+	MaxEntries int64 `yaml:"max_entries" env:"CACHE_MAX_ENTRIES" env-default:"100000"`
+	MaxBytes   int64 `yaml:"max_bytes" env:"CACHE_MAX_BYTES" env-default:"268435456"`
+	// CleanupInterval — как часто driver: memory удаляет истёкшие записи; "0" — только при чтении.
+	CleanupInterval string `yaml:"cleanup_interval" env:"CACHE_CLEANUP_INTERVAL" env-default:"1m"`
+	// Redis: ACL-пользователь, Sentinel (master_name + addrs), Cluster (cluster + addrs), TLS, пул и таймауты.
+	Username         string   `yaml:"username" env:"CACHE_USERNAME"`
+	Addrs            []string `yaml:"addrs" env:"CACHE_ADDRS" env-separator:","` // узлы Cluster или адреса Sentinel; пусто — host:port
+	Cluster          bool     `yaml:"cluster" env:"CACHE_CLUSTER"`
+	MasterName       string   `yaml:"master_name" env:"CACHE_MASTER_NAME"`
+	SentinelUsername string   `yaml:"sentinel_username" env:"CACHE_SENTINEL_USERNAME"`
+	SentinelPassword string   `yaml:"sentinel_password" env:"CACHE_SENTINEL_PASSWORD"`
+	// TLS к Redis: секция tls (CA, mTLS, SNI) или CACHE_TLS=true с системными CA.
+	TLS          *ClientTLS `yaml:"tls,omitempty"`
+	TLSEnabled   bool       `yaml:"tls_enabled" env:"CACHE_TLS"`
+	PoolSize     int        `yaml:"pool_size" env:"CACHE_POOL_SIZE"`
+	MinIdleConns int        `yaml:"min_idle_conns" env:"CACHE_MIN_IDLE_CONNS"`
+	DialTimeout  string     `yaml:"dial_timeout" env:"CACHE_DIAL_TIMEOUT" env-default:"1s"`
+	ReadTimeout  string     `yaml:"read_timeout" env:"CACHE_READ_TIMEOUT" env-default:"500ms"`
+	WriteTimeout string     `yaml:"write_timeout" env:"CACHE_WRITE_TIMEOUT" env-default:"500ms"`
+	PoolTimeout  string     `yaml:"pool_timeout" env:"CACHE_POOL_TIMEOUT"`
+	// KeyPrefix — пространство имён ключей в Redis; {env} — APP_ENV, {version} — version конфига.
+	KeyPrefix string `yaml:"key_prefix" env:"CACHE_KEY_PREFIX"`
+	// Compression — gzip или zstd для значений в Redis не меньше CompressMinBytes; пусто — без сжатия.
+	Compression      string `yaml:"compression" env:"CACHE_COMPRESSION"`
+	CompressMinBytes int    `yaml:"compress_min_bytes" env:"CACHE_COMPRESS_MIN_BYTES" env-default:"1024"`
+	// ConfigVersion — version из конфига (для {version} в key_prefix), заполняется Build.
+	ConfigVersion string `yaml:"-"`
+	// L1TTL — сколько driver: tiered держит запись в памяти процесса перед Redis.
+	L1TTL string `yaml:"l1_ttl" env:"CACHE_L1_TTL" env-default:"5s"`
+	// Warmup — прогрев кэша: шлюз сам запрашивает эти URL при старте и, если задан interval, периодически.
+	Warmup Warmup `yaml:"warmup"`
+}
+
+// Warmup — что и как прогревать. Пока идёт первый прогрев, /ready отвечает 503.
+type Warmup struct {
+	// URLs — "/posts/1", "GET /posts?page=1" или абсолютный URL (для endpoint с match.host).
+	URLs []string `yaml:"urls"`
+	// Paths — шаблоны путей с {param}; запрашиваются все сочетания значений params.
+	Paths []WarmupPath `yaml:"paths"`
+	// File — файл с URL в формате urls, по одному в строке (# — комментарий); перечитывается при каждом прогреве.
+	File string `yaml:"file" env:"CACHE_WARMUP_FILE"`
+	// Interval — период повторного прогрева (меньше cache_ttl, чтобы записи обновлялись до истечения); пусто — только при старте.
+	Interval    string            `yaml:"interval" env:"CACHE_WARMUP_INTERVAL"`
+	Concurrency int               `yaml:"concurrency" env:"CACHE_WARMUP_CONCURRENCY" env-default:"4"`
+	Headers     map[string]string `yaml:"headers"` // добавляются к каждому запросу прогрева (например X-Tenant-Id)
+}
+
+type WarmupPath struct {
+	Method string              `yaml:"method"` // по умолчанию GET
+	Path   string              `yaml:"path"`   // "/posts/{id}?lang={lang}"
+	Params map[string][]string `yaml:"params"` // {id: [1, 2], lang: [ru, en]}
 }
 
 type Service struct {
@@ -42,24 +133,136 @@ type Service struct {
 	ProxyURL  string `yaml:"proxy_url"`
 	Timeout   string `yaml:"timeout"`
 	Transport string `yaml:"transport,omitempty"`
+	// Protocol — протокол HTTP-клиента к сервису: http1, h2 (только TLS), h2c (HTTP/2 без TLS) или auto (по умолчанию).
+	Protocol string `yaml:"protocol,omitempty"`
+	// Client — пул соединений, таймауты и TLS HTTP-клиента к сервису.
+	Client *ServiceClient `yaml:"client,omitempty"`
+	// Для transport: grpc — откуда брать дескрипторы: файл FileDescriptorSet
+	// (protoc --include_imports --descriptor_set_out) или server reflection.
+	DescriptorSet string `yaml:"descriptor_set,omitempty"`
+	Reflection    bool   `yaml:"reflection,omitempty"`
+}
+
+type ServiceClient struct {
+	MaxIdleConns          int        `yaml:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost   int        `yaml:"max_idle_conns_per_host,omitempty"`
+	MaxConnsPerHost       int        `yaml:"max_conns_per_host,omitempty"`
+	IdleConnTimeout       string     `yaml:"idle_conn_timeout,omitempty"`
+	KeepAlive             string     `yaml:"keep_alive,omitempty"`
+	DialTimeout           string     `yaml:"dial_timeout,omitempty"`
+	TLSHandshakeTimeout   string     `yaml:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout string     `yaml:"response_header_timeout,omitempty"`
+	TLS                   *ClientTLS `yaml:"tls,omitempty"`
+}
+
+type ClientTLS struct {
+	CAFile             string `yaml:"ca_file,omitempty"`   // PEM с CA для проверки сервера (дополнительно к системным)
+	CertFile           string `yaml:"cert_file,omitempty"` // клиентский сертификат для mTLS
+	KeyFile            string `yaml:"key_file,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty"` // переопределение SNI/имени для проверки
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
 }
 
 type Endpoint struct {
 	Path            string            `yaml:"path"`
 	Method          string            `yaml:"method"`
+	Match           *Match            `yaml:"match,omitempty"`
+	Priority        int               `yaml:"priority,omitempty"` // выше — проверяется раньше среди endpoint с тем же path+method
 	Backend         *Backend          `yaml:"backend,omitempty"`
 	Calls           []AggCall         `yaml:"calls,omitempty"`
 	ResponseMapping map[string]string `yaml:"response_mapping,omitempty"`
 	AuthRequired    bool              `yaml:"auth_required,omitempty"`
 	FailOnError     *bool             `yaml:"fail_on_error,omitempty"`
 	CacheTTL        string            `yaml:"cache_ttl,omitempty"`
-	Middlewares     []string          `yaml:"middlewares,omitempty"`
+	// После cache_ttl запись ещё живёт: в окне stale_while_revalidate отдаётся сразу и обновляется в фоне,
+	// в окне stale_if_error — отдаётся, только если backend вернул ошибку/5xx или не ответил.
+	CacheStaleWhileRevalidate string `yaml:"cache_stale_while_revalidate,omitempty"`
+	CacheStaleIfError         string `yaml:"cache_stale_if_error,omitempty"`
+	// CacheMode: ttl — кэшировать на cache_ttl; http — по Cache-Control/Expires/Vary upstream (RFC 9111).
+	// Пусто — cache.mode.
+	CacheMode string `yaml:"cache_mode,omitempty"`
+	// CacheKey — из чего состоит ключ кэша. Без него ответы на запросы с Authorization не кэшируются.
+	CacheKey *CacheKey `yaml:"cache_key,omitempty"`
+	// CacheTags — теги кэшированного ответа для точечного сброса (/admin/cache/purge), например "post:{id}";
+	// {name} — параметр маршрута.
+	CacheTags []string `yaml:"cache_tags,omitempty"`
+	// Invalidates — что сбросить из кэша после успешного (2xx) ответа этого endpoint:
+	// GET-маршруты ("/posts/{id}", "/posts") или теги ("tag:post:{id}").
+	Invalidates []string `yaml:"invalidates,omitempty"`
+	Timeout     string   `yaml:"timeout,omitempty"` // общий дедлайн запроса (вся агрегация), поверх таймаутов сервисов
+	Middlewares []string `yaml:"middlewares,omitempty"`
+	// Streaming — SSE/long-poll: ответ отдаётся по мере поступления, без кэша и без таймаута записи.
+	Streaming bool `yaml:"streaming,omitempty"`
+	// WebSocket включает режим проксирования WebSocket к backend.service (ws/wss).
+	WebSocket *WebSocket `yaml:"websocket,omitempty"`
+}
+
+// Match — дополнительные условия выбора endpoint поверх path+method.
+// Значение "*" означает «заголовок/параметр/cookie присутствует с любым значением».
+type Match struct {
+	Host    string            `yaml:"host,omitempty"` // "api.example.com" или "*.example.com"
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Query   map[string]string `yaml:"query,omitempty"`
+	Cookies map[string]string `yaml:"cookies,omitempty"`
+}
+
+// CacheKey дополняет ключ кэша METHOD:path?query частями запроса.
+type CacheKey struct {
+	Headers []string `yaml:"headers,omitempty"` // значения заголовков (например X-Tenant-Id)
+	Claims  []string `yaml:"claims,omitempty"`  // claims Bearer JWT; подпись не проверяется, поэтому в ключ входит и хэш токена
+	Cookies []string `yaml:"cookies,omitempty"`
+	// IgnoreCookies — ответ не зависит от cookies: запросы с Cookie кэшируются общим ключом.
+	// Без него запрос с Cookie кэшируется, только если нужные cookies перечислены в Cookies.
+	IgnoreCookies bool `yaml:"ignore_cookies,omitempty"`
+	// QueryInclude — оставить в ключе только эти query-параметры; QueryIgnore — выбросить
+	// (допускается суффикс "*": utm_*). SortQuery делает ключ независимым от порядка параметров.
+	QueryInclude []string `yaml:"query_include,omitempty"`
+	QueryIgnore  []string `yaml:"query_ignore,omitempty"`
+	SortQuery    bool     `yaml:"sort_query,omitempty"`
+	// MaxLength — ключ длиннее заменяется на METHOD:path#sha256 (0 — не хэшировать).
+	MaxLength int `yaml:"max_length,omitempty"`
+	// Body включает кэширование POST/QUERY: в ключ добавляется sha256 тела запроса
+	// (JSON канонизируется — порядок полей и пробелы не важны). Тела больше MaxBodyBytes
+	// (по умолчанию 64 KiB) и тела без Content-Length не кэшируются.
+	Body         bool  `yaml:"body,omitempty"`
+	MaxBodyBytes int64 `yaml:"max_body_bytes,omitempty"`
+}
+
+type WebSocket struct {
+	IdleTimeout    string `yaml:"idle_timeout,omitempty"`     // закрыть соединение без трафика в обе стороны
+	MaxMessageSize int64  `yaml:"max_message_size,omitempty"` // байт, 0 — без ограничения
 }
 
 type Backend struct {
-	Service string `yaml:"service"`
-	Path    string `yaml:"path"`
-	Method  string `yaml:"method"`
+	Service string  `yaml:"service"`
+	Path    string  `yaml:"path"`
+	Method  string  `yaml:"method"`
+	Split   *Split  `yaml:"split,omitempty"`
+	Mirror  *Mirror `yaml:"mirror,omitempty"`
+}
+
+// Mirror асинхронно дублирует запросы в теневой сервис; его ответ клиенту не отдаётся.
+type Mirror struct {
+	Service       string  `yaml:"service"`
+	Percent       float64 `yaml:"percent,omitempty"`        // доля зеркалируемых запросов, 0 = 100%
+	MaxConcurrent int     `yaml:"max_concurrent,omitempty"` // лимит одновременных теневых запросов, по умолчанию 16
+	MaxBodyBytes  int64   `yaml:"max_body_bytes,omitempty"` // тела больше не зеркалируются, по умолчанию cache.max_body_bytes
+	LogDiff       bool    `yaml:"log_diff,omitempty"`       // логировать расхождения статуса/тела
+}
+
+// Split распределяет трафик backend между несколькими сервисами (canary).
+type Split struct {
+	Name    string        `yaml:"name,omitempty"` // id для admin API, по умолчанию "METHOD path" (+ условия match)
+	Targets []SplitTarget `yaml:"targets"`
+	// Sticky — чем закреплять клиента за вариантом: cookie:<name>, header:<name> или claim:<name> (из JWT).
+	Sticky string `yaml:"sticky,omitempty"`
+	// ForceHeader — заголовок, в котором тестировщик может явно указать имя сервиса.
+	ForceHeader string `yaml:"force_header,omitempty"`
+}
+
+type SplitTarget struct {
+	Service string `yaml:"service" json:"service"`
+	Weight  int    `yaml:"weight" json:"weight"`
 }
 
 type AggCall struct {
@@ -68,6 +271,15 @@ type AggCall struct {
 	Path    string            `yaml:"path"`
 	Method  string            `yaml:"method"`
 	Mapping map[string]string `yaml:"mapping,omitempty"` // { "title": "title", "body": "body" }
+	// CacheTTL кэширует успешный (2xx) ответ этого вызова отдельно от итога агрегации.
+	// Ключ — сам запрос к сервису (сервис, метод, путь, query), поэтому одинаковые вызовы
+	// разных endpoint делят одну запись. Пусто — вызов не кэшируется.
+	CacheTTL string `yaml:"cache_ttl,omitempty"`
+	// CacheKey — из чего ещё состоит ключ вызова (headers/claims/cookies, query_*, max_length);
+	// без него вызов при запросе с Authorization не кэшируется.
+	CacheKey *CacheKey `yaml:"cache_key,omitempty"`
+	// CacheTags — теги записи вызова ("user:{id}") для сброса через purge/invalidates.
+	CacheTags []string `yaml:"cache_tags,omitempty"`
 }
 
 type FinalConfig struct {
@@ -132,9 +344,12 @@ func Build(configPath string) (*FinalConfig, error) {
 		endpoints = append(endpoints, incEndpoints...)
 	}
 
+	cache := raw.Cache
+	cache.ConfigVersion = raw.Version
+
 	return &FinalConfig{
 		Gateway:   raw.Gateway,
-		Cache:     raw.Cache,
+		Cache:     cache,
 		Services:  services,
 		Endpoints: endpoints,
 	}, nil
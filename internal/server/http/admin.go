@@ -0,0 +1,133 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+// registerAdminRoutes монтирует служебный API под /admin; доступ по Bearer-токену gateway.admin.token.
+func registerAdminRoutes(app *fiber.App, cfg config.Admin) {
+	admin := app.Group("/admin", adminAuth(cfg.Token), bufferRequestBody)
+
+	admin.Get("/splits", func(c *fiber.Ctx) error {
+		type splitView struct {
+			ID      string               `json:"id"`
+			Targets []config.SplitTarget `json:"targets"`
+		}
+		var out []splitView
+		splits.Range(func(_, v any) bool {
+			st := v.(*splitState)
+			out = append(out, splitView{ID: st.id, Targets: *st.targets.Load()})
+			return true
+		})
+		sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+		return c.JSON(out)
+	})
+
+	// PUT /admin/splits {"id":"GET /api/x","targets":[{"service":"a","weight":90},...]}
+	admin.Put("/splits", func(c *fiber.Ctx) error {
+		var req struct {
+			ID      string               `json:"id"`
+			Targets []config.SplitTarget `json:"targets"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).SendString("invalid body: " + err.Error())
+		}
+		v, ok := splits.Load(req.ID)
+		if !ok {
+			return c.Status(http.StatusNotFound).SendString("unknown split")
+		}
+		if err := v.(*splitState).setWeights(req.Targets); err != nil {
+			return c.Status(http.StatusBadRequest).SendString(err.Error())
+		}
+		reqLogger(c)("[waiterd][admin] split %q weights updated: %+v", req.ID, req.Targets)
+		return c.SendStatus(http.StatusNoContent)
+	})
+
+	admin.Get("/cache/stats", func(c *fiber.Ctx) error {
+		m, ok := CacheInstance.(interface{ Stats() memoryCacheStats })
+		if !ok {
+			return c.Status(http.StatusNotImplemented).SendString("cache driver has no stats")
+		}
+		return c.JSON(m.Stats())
+	})
+
+	// POST /admin/cache/purge {"keys":[...],"endpoint":"/posts/:id","url":"/posts/1","prefix":"/api/","pattern":"GET:/x*","tags":["post:1"]}
+	admin.Post("/cache/purge", func(c *fiber.Ctx) error {
+		var req struct {
+			Keys     []string `json:"keys"`
+			Endpoint string   `json:"endpoint"` // маршрут из конфига; :param совпадает с любым значением
+			URL      string   `json:"url"`      // путь запроса, с любым query
+			Prefix   string   `json:"prefix"`   // все пути с этим началом
+			Pattern  string   `json:"pattern"`  // glob по самим ключам (как в Redis SCAN MATCH)
+			Tags     []string `json:"tags"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).SendString("invalid body: " + err.Error())
+		}
+		if CacheInstance == nil {
+			return c.Status(http.StatusNotImplemented).SendString("cache disabled")
+		}
+
+		var patterns []string
+		if req.Endpoint != "" {
+			patterns = append(patterns, urlPatterns(routeGlob(req.Endpoint), false)...)
+		}
+		if req.URL != "" {
+			patterns = append(patterns, urlPatterns(escapeGlob(req.URL), false)...)
+		}
+		if req.Prefix != "" {
+			patterns = append(patterns, urlPatterns(escapeGlob(req.Prefix), true)...)
+		}
+		if req.Pattern != "" {
+			patterns = append(patterns, req.Pattern)
+		}
+		if len(req.Keys) == 0 && len(req.Tags) == 0 && len(patterns) == 0 {
+			return c.Status(http.StatusBadRequest).SendString("nothing to purge")
+		}
+
+		ctx := c.UserContext()
+		total := 0
+		var n int
+		var err error
+		if len(req.Keys) > 0 {
+			if n, err = purgeKeys(ctx, req.Keys...); err == nil {
+				total += n
+			}
+		}
+		if err == nil && len(req.Tags) > 0 {
+			if n, err = purgeTags(ctx, req.Tags...); err == nil {
+				total += n
+			}
+		}
+		if err == nil && len(patterns) > 0 {
+			n, err = purgeMatch(ctx, patterns...)
+			total += n
+		}
+		switch {
+		case errors.Is(err, errPurgeUnsupported):
+			return c.Status(http.StatusNotImplemented).SendString(err.Error())
+		case err != nil:
+			return c.Status(http.StatusBadGateway).SendString("purge failed: " + err.Error())
+		}
+		reqLogger(c)("[waiterd][admin] cache purge keys=%v tags=%v patterns=%v: %d entries", req.Keys, req.Tags, patterns, total)
+		return c.JSON(fiber.Map{"purged": total})
+	})
+}
+
+func adminAuth(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		got, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return c.Status(http.StatusUnauthorized).SendString("unauthorized")
+		}
+		return c.Next()
+	}
+}
@@ -1,6 +1,7 @@
 package httpserver
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -21,78 +22,192 @@ func makeAggregateHandler(services map[string]config.Service, ep config.Endpoint
 	return func(c *fiber.Ctx) error {
 		logReq := reqLogger(c)
 
-		ttlToUse := DefaultCacheTTL
-		if ep.CacheTTL != "" {
-			if d, err := time.ParseDuration(ep.CacheTTL); err == nil {
-				ttlToUse = d
-			}
-		}
+		windows := endpointCacheWindows(ep.CacheTTL, ep.CacheStaleWhileRevalidate, ep.CacheStaleIfError)
+		ttlToUse := windows.ttl
+		in := aggregateInputFrom(c, ep)
 
-		cacheKey := c.Method() + ":" + c.OriginalURL()
-		if CacheInstance != nil && ttlToUse > 0 {
-			if data, ok, err := CacheInstance.Get(c.UserContext(), cacheKey); err == nil && ok {
+		cacheKey, keyErr := cacheKeyFor(c, ep)
+		if keyErr != nil && ttlToUse > 0 {
+			logReq("[waiterd][cache] skip path=%s: %v", c.Path(), keyErr)
+		}
+		cacheOn := CacheInstance != nil && ttlToUse > 0 && keyErr == nil
+		tags := cacheTags(c, ep, in.params)
+		var stale *cachedHTTPResponse
+		var share *fillResult
+		if cacheOn && !isWarmup(c) {
+			entry, state := lookupCached(c.UserContext(), cacheKey, windows, nil)
+			switch state {
+			case cacheFresh:
 				logReq("[waiterd][cache] hit key=%s path=%s", cacheKey, c.Path())
-				var anyv any
-				if err := json.Unmarshal(data, &anyv); err == nil {
-					return c.JSON(anyv)
+				return writeCachedResponse(c, entry, "")
+			case cacheStaleRevalidate:
+				logReq("[waiterd][cache] stale key=%s path=%s, revalidating", cacheKey, c.Path())
+				revalidateInBackground(c.UserContext(), cacheKey, aggregateTimeout(ep), logReq, func(ctx context.Context) error {
+					final, err := runAggregate(ctx, services, ep, in, logReq)
+					if err != nil {
+						return err
+					}
+					entry, err := aggregateCacheEntry(final, ttlToUse)
+					if err != nil {
+						return err
+					}
+					storeCachedResponse(ctx, cacheKey, entry, windows.storeTTL())
+					tagCached(ctx, cacheKey, tags, windows.storeTTL())
+					return nil
+				})
+				return writeCachedResponse(c, entry, warningStale)
+			case cacheStaleIfError:
+				stale = entry
+			}
+
+			leader, shared, release := coalesceFill(c.UserContext(), cacheKey)
+			defer func() { release(share) }()
+			if !leader {
+				if entry, ok := shared.forRequest(nil); ok {
+					logReq("[waiterd][cache] coalesced key=%s", cacheKey)
+					return writeCacheEntry(c, entry, "COALESCED", shared.warning)
+				}
+				if entry, state := lookupCached(c.UserContext(), cacheKey, windows, nil); state == cacheFresh {
+					logReq("[waiterd][cache] coalesced key=%s", cacheKey)
+					return writeCachedResponse(c, entry, "")
 				}
-				return c.SendString(string(data))
 			}
-		} else if ttlToUse > 0 {
+		} else if CacheInstance == nil && ttlToUse > 0 {
 			logReq("[waiterd][cache] disabled driver or instance nil; path=%s ttl=%s", c.Path(), ttlToUse)
 		}
 
-		perCall := make(map[string]any)
+		reqCtx, cancel := requestContext(c, ep)
+		defer cancel()
 
-		var mu sync.Mutex
-		g, gctx := errgroup.WithContext(c.Context())
+		final, err := runAggregate(reqCtx, services, ep, in, logReq)
+		if err != nil {
+			logReq("[waiterd] aggregate error: %v", err)
+			if stale != nil {
+				logReq("[waiterd][cache] serving stale key=%s after aggregate error", cacheKey)
+				share = newFillResult(stale, warningRevalidateFailed, nil)
+				return writeCachedResponse(c, stale, warningRevalidateFailed)
+			}
+			if errors.Is(reqCtx.Err(), context.DeadlineExceeded) {
+				return c.Status(http.StatusGatewayTimeout).SendString("aggregate deadline exceeded")
+			}
+			return c.Status(http.StatusBadGateway).SendString("backend error in aggregate")
+		}
 
-		failOnError := true
-		if ep.FailOnError != nil {
-			failOnError = *ep.FailOnError
+		entry, err := aggregateCacheEntry(final, ttlToUse)
+		if err != nil {
+			return err
+		}
+		if cacheOn {
+			storeCachedResponse(c.UserContext(), cacheKey, entry, windows.storeTTL())
+			tagCached(c.UserContext(), cacheKey, tags, windows.storeTTL())
+			c.Set(XCacheHeader, "MISS")
+			share = newFillResult(entry, "", nil)
+		}
+		for k, v := range entry.Headers {
+			c.Set(k, v)
 		}
+		return sendWithValidators(c, entry.Status, entry.Headers, entry.Body)
+	}
+}
 
-		for _, call := range ep.Calls {
-			call := call
-			g.Go(func() error {
-				startCall := time.Now()
-
-				svc, ok := services[call.Service]
-				if !ok {
-					msg := fmt.Sprintf("unknown service %q", call.Service)
-					logReq("[waiterd] aggregate call %s error: %s", call.Name, msg)
-					if failOnError {
-						return errors.New(msg)
-					}
-					mu.Lock()
-					perCall[call.Name] = map[string]any{"_error": msg}
-					mu.Unlock()
-					return nil
-				}
+// aggregateInput — всё, что агрегации нужно от входящего запроса. Не ссылается на fiber.Ctx,
+// поэтому агрегацию можно повторить в фоне после ответа клиенту.
+type aggregateInput struct {
+	path     string
+	rawQuery string
+	params   map[string]string
+	fwd      http.Header
+	callKeys map[string]string // call.Name -> часть ключа кэша вызова (callKeyParts)
+	refresh  bool              // прогрев: кэш вызовов не читается, только перезаписывается
+}
 
-				if strings.TrimSpace(strings.ToLower(svc.Transport)) == "grpc" {
-					msg := fmt.Sprintf("grpc in aggregate not implemented for service %q", svc.Name)
-					logReq("[waiterd] aggregate call %s error: %s", call.Name, msg)
-					if failOnError {
-						return errors.New(msg)
-					}
-					mu.Lock()
-					perCall[call.Name] = map[string]any{"_error": msg}
-					mu.Unlock()
-					return nil
-				}
+func aggregateInputFrom(c *fiber.Ctx, ep config.Endpoint) aggregateInput {
+	params := c.AllParams()
+	for k, v := range params {
+		params[k] = strings.Clone(v)
+	}
+	fwd := forwardHeadersFromFiber(c)
+	detachHeader(fwd)
+	return aggregateInput{
+		path:     strings.Clone(c.Path()),
+		rawQuery: strings.Clone(rawQueryFromOriginal(c.OriginalURL())),
+		params:   params,
+		fwd:      fwd,
+		callKeys: callKeyParts(c, ep),
+		refresh:  isWarmup(c),
+	}
+}
+
+// aggregateTimeout bounds a background re-run of the aggregate (endpoint timeout or 30s).
+func aggregateTimeout(ep config.Endpoint) time.Duration {
+	if d := parseTTL(ep.Timeout); d > 0 {
+		return d
+	}
+	return 30 * time.Second
+}
+
+func aggregateCacheEntry(final any, ttl time.Duration) (*cachedHTTPResponse, error) {
+	body, err := json.Marshal(final)
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{
+		fiber.HeaderContentType: fiber.MIMEApplicationJSON,
+		headerETag:              strongETag(body),
+	}
+	return newCachedResponse(http.StatusOK, headers, body, ttl), nil
+}
+
+// runAggregate выполняет calls параллельно и собирает итоговый ответ по response_mapping.
+func runAggregate(ctx context.Context, services map[string]config.Service, ep config.Endpoint, in aggregateInput, logReq func(string, ...any)) (any, error) {
+	perCall := make(map[string]any)
+
+	var mu sync.Mutex
+	g, gctx := errgroup.WithContext(ctx)
+
+	params := in.params
+	fwd := in.fwd
+
+	failOnError := true
+	if ep.FailOnError != nil {
+		failOnError = *ep.FailOnError
+	}
 
-				resolvedPath := resolvePathTemplate(ep.Path, call.Path, c.Path())
-				rawQuery := rawQueryFromOriginal(c.OriginalURL())
-				methodToUse := call.Method
-				if methodToUse == "" {
-					methodToUse = http.MethodGet
+	for _, call := range ep.Calls {
+		call := call
+		g.Go(func() error {
+			startCall := time.Now()
+
+			svc, ok := services[call.Service]
+			if !ok {
+				msg := fmt.Sprintf("unknown service %q", call.Service)
+				logReq("[waiterd] aggregate call %s error: %s", call.Name, msg)
+				if failOnError {
+					return errors.New(msg)
 				}
+				mu.Lock()
+				perCall[call.Name] = map[string]any{"_error": msg}
+				mu.Unlock()
+				return nil
+			}
 
-				targetURL := buildTargetURL(svc.ProxyURL, resolvedPath, rawQuery)
+			resolvedPath := resolvePathTemplate(ep.Path, call.Path, in.path)
+			rawQuery := in.rawQuery
+			methodToUse := call.Method
+			if methodToUse == "" {
+				methodToUse = http.MethodGet
+			}
 
-				fwd := forwardHeadersFromFiber(c)
-				bodyBytes, status, err := doHTTPCall(
+			targetURL := buildTargetURL(svc.ProxyURL, resolvedPath, rawQuery)
+
+			isGRPC := strings.TrimSpace(strings.ToLower(svc.Transport)) == "grpc"
+			fetch := func() ([]byte, int, error) {
+				if isGRPC {
+					// для gRPC call.path — это /package.Service/Method, параметры берутся из маршрута и query
+					query, _ := url.ParseQuery(rawQuery)
+					return callGRPC(gctx, svc, call.Path, nil, params, query, fwd)
+				}
+				return doHTTPCall(
 					gctx,
 					svc,
 					call.Method,
@@ -101,80 +216,86 @@ func makeAggregateHandler(services map[string]config.Service, ep config.Endpoint
 					nil,
 					fwd,
 				)
-				if err != nil {
-					logReq("[waiterd] aggregate call %s -> svc=%s error: %v", call.Name, svc.Name, err)
-					if failOnError {
-						return fmt.Errorf("aggregate call %s -> svc=%s error: %w", call.Name, svc.Name, err)
-					}
-					mu.Lock()
-					perCall[call.Name] = map[string]any{"_error": err.Error()}
-					mu.Unlock()
-					return nil
-				}
+			}
 
-				if status >= 400 {
-					if failOnError {
-						logReq("[waiterd] aggregate call %s -> svc=%s returned status=%d -> aggregate will fail", call.Name, svc.Name, status)
-						return fmt.Errorf("downstream status %d", status)
-					}
-					logReq("[waiterd] downstream call %s -> svc=%s returned status=%d (tolerated)", call.Name, svc.Name, status)
+			var bodyBytes []byte
+			var status int
+			var err error
+			keyPath := resolvedPath
+			if isGRPC {
+				keyPath = call.Path
+			}
+			if cc, ok := in.callCacheFor(call, svc, methodToUse, keyPath, isGRPC); ok {
+				var hit bool
+				bodyBytes, status, hit, err = cc.do(gctx, fetch)
+				if hit {
+					logReq("[waiterd][cache] hit key=%s call=%s", cc.key, call.Name)
 				}
-
-				value := decodeWithMapping(bodyBytes, call.Mapping)
-				if status >= 400 && value == nil {
-					value = fmt.Sprintf("status=%d", status)
+			} else {
+				bodyBytes, status, err = fetch()
+			}
+			if err != nil {
+				logReq("[waiterd] aggregate call %s -> svc=%s error: %v", call.Name, svc.Name, err)
+				if failOnError {
+					return fmt.Errorf("aggregate call %s -> svc=%s error: %w", call.Name, svc.Name, err)
 				}
-
-				logReq("[waiterd][call] name=%s svc=%s url=%s method=%s status=%d in=%s", call.Name, svc.Name, targetURL, methodToUse, status, time.Since(startCall))
-
 				mu.Lock()
-				perCall[call.Name] = value
-				if status >= 400 {
-					perCall[call.Name+"_error"] = fmt.Sprintf("status=%d", status)
-				}
+				perCall[call.Name] = map[string]any{"_error": err.Error()}
 				mu.Unlock()
-
 				return nil
-			})
-		}
-
-		if err := g.Wait(); err != nil {
-			logReq("[waiterd] aggregate error: %v", err)
-			return c.Status(http.StatusBadGateway).SendString("backend error in aggregate")
-		}
+			}
 
-		final := buildAggregateResponse(ep.ResponseMapping, perCall)
+			if status >= 400 {
+				if failOnError {
+					logReq("[waiterd] aggregate call %s -> svc=%s returned status=%d -> aggregate will fail", call.Name, svc.Name, status)
+					return fmt.Errorf("downstream status %d", status)
+				}
+				logReq("[waiterd] downstream call %s -> svc=%s returned status=%d (tolerated)", call.Name, svc.Name, status)
+			}
 
-		if CacheInstance != nil && ttlToUse > 0 {
-			if data, err := json.Marshal(final); err == nil {
-				_ = CacheInstance.Set(c.UserContext(), cacheKey, data, ttlToUse)
+			value := decodeWithMapping(bodyBytes, call.Mapping)
+			if status >= 400 && value == nil {
+				value = fmt.Sprintf("status=%d", status)
 			}
-		}
 
-		var errs []string
-		for k, v := range perCall {
-			if strings.HasSuffix(k, "_error") {
-				errKey := strings.TrimSuffix(k, "_error")
-				errStr := fmt.Sprintf("%s=%v", errKey, v)
-				errs = append(errs, errStr)
+			logReq("[waiterd][call] name=%s svc=%s url=%s method=%s status=%d in=%s", call.Name, svc.Name, targetURL, methodToUse, status, time.Since(startCall))
+
+			mu.Lock()
+			perCall[call.Name] = value
+			if status >= 400 {
+				perCall[call.Name+"_error"] = fmt.Sprintf("status=%d", status)
 			}
-		}
-		if len(errs) > 0 {
-			logReq("[waiterd] aggregate completed with downstream errors: %s", strings.Join(errs, ", "))
-		}
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
 
-		return c.JSON(final)
+	final := buildAggregateResponse(ep.ResponseMapping, perCall)
+
+	var errs []string
+	for k, v := range perCall {
+		if strings.HasSuffix(k, "_error") {
+			errKey := strings.TrimSuffix(k, "_error")
+			errStr := fmt.Sprintf("%s=%v", errKey, v)
+			errs = append(errs, errStr)
+		}
+	}
+	if len(errs) > 0 {
+		logReq("[waiterd] aggregate completed with downstream errors: %s", strings.Join(errs, ", "))
 	}
+
+	return final, nil
 }
 
 func buildTargetURL(proxy string, path string, rawQuery string) string {
-	baseURL := proxy
-	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
-		baseURL = "http://" + baseURL
-	}
-	base, err := url.Parse(baseURL)
+	base, err := parseBaseURL(proxy)
 	if err != nil {
-		return baseURL
+		return proxy
 	}
 	t := *base
 	t.Path = singleJoinPath(base.Path, path)
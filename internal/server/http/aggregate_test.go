@@ -84,3 +84,70 @@ func TestAggregate_CachesFinalResponse(t *testing.T) {
 		t.Fatalf("backend hits after cache a=%d b=%d", hitA, hitB)
 	}
 }
+
+func TestAggregate_PerCallCache(t *testing.T) {
+	t.Cleanup(func() { CacheInstance = nil })
+	CacheInstance = newMemoryCacheAdapter()
+
+	hitShared, hitMe := int32(0), int32(0)
+	shared := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hitShared, 1)
+		w.Write([]byte(`{"theme":"dark"}`))
+	}))
+	me := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hitMe, 1)
+		w.Write([]byte(`{"auth":"` + r.Header.Get("Authorization") + `"}`))
+	}))
+	t.Cleanup(func() {
+		shared.Close()
+		me.Close()
+	})
+
+	services := map[string]config.Service{
+		"shared": {Name: "shared", ProxyURL: shared.URL},
+		"me":     {Name: "me", ProxyURL: me.URL},
+	}
+	// пустой cache_key явно разрешает общий кэш вызова для запросов с Authorization
+	settings := config.AggCall{Name: "settings", Service: "shared", Path: "/settings", CacheTTL: "1m",
+		CacheKey: &config.CacheKey{}}
+	profile := config.AggCall{Name: "profile", Service: "me", Path: "/me", CacheTTL: "1m",
+		CacheKey: &config.CacheKey{Claims: []string{"sub"}}}
+
+	// итог агрегации не кэшируется (нет cache_ttl), вызовы — каждый по своей политике
+	app := fiber.New()
+	app.Get("/dash", makeEndpointHandler(services, config.Endpoint{Path: "/dash", Calls: []config.AggCall{settings, profile}}))
+	app.Get("/feed", makeEndpointHandler(services, config.Endpoint{Path: "/feed", Calls: []config.AggCall{settings}}))
+
+	get := func(path, auth string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", auth)
+		resp, err := app.Test(req, 2000)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: err=%v resp=%v", path, err, resp)
+		}
+	}
+	alice, bob := testJWT(`{"sub":"alice"}`), testJWT(`{"sub":"bob"}`)
+
+	get("/dash", alice)
+	get("/dash", alice)
+	if atomic.LoadInt32(&hitShared) != 1 || atomic.LoadInt32(&hitMe) != 1 {
+		t.Fatalf("hits shared=%d me=%d, want 1 1", hitShared, hitMe)
+	}
+	// общий вызов переиспользуется другим endpoint и другим пользователем,
+	// персональный — кэшируется по sub
+	get("/feed", bob)
+	get("/dash", bob)
+	if atomic.LoadInt32(&hitShared) != 1 || atomic.LoadInt32(&hitMe) != 2 {
+		t.Fatalf("hits shared=%d me=%d, want 1 2", hitShared, hitMe)
+	}
+
+	// без cache_key вызов при запросе с Authorization не кэшируется
+	app.Get("/raw", makeEndpointHandler(services, config.Endpoint{Path: "/raw",
+		Calls: []config.AggCall{{Name: "profile", Service: "me", Path: "/me", CacheTTL: "1m"}}}))
+	get("/raw", alice)
+	get("/raw", bob)
+	if atomic.LoadInt32(&hitMe) != 4 {
+		t.Fatalf("hits me=%d, want 4", hitMe)
+	}
+}
@@ -3,11 +3,11 @@ package httpserver
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
 	"time"
 
@@ -17,41 +17,17 @@ import (
 )
 
 // proxyHTTP проксирует запрос к backend-сервису с учётом cache_ttl и логирует с reqID.
-func proxyHTTP(c *fiber.Ctx, svc config.Service, ep config.Endpoint) error {
+// shadow (может быть nil) получает асинхронную копию запроса, если тот ушёл в upstream.
+func proxyHTTP(c *fiber.Ctx, svc config.Service, ep config.Endpoint, shadow *shadowTarget) error {
 	logReq := reqLogger(c)
 
-	// Safety: cache only GET/HEAD by default. Otherwise key must include request body/hash.
-	cacheableMethod := c.Method() == http.MethodGet || c.Method() == http.MethodHead
+	// Safety: cache only GET/HEAD by default. POST/QUERY only with cache_key.body — the key
+	// then includes a hash of the request body. Streaming endpoints (SSE/long-poll) are never cached.
+	cacheableMethod := !ep.Streaming &&
+		(c.Method() == http.MethodGet || c.Method() == http.MethodHead || bodyKeyed(ep, c.Method()))
 
-	ttlToUse := DefaultCacheTTL
-	if ep.CacheTTL != "" {
-		if d, err := time.ParseDuration(ep.CacheTTL); err == nil {
-			ttlToUse = d
-		} else if secs, err := strconv.Atoi(ep.CacheTTL); err == nil {
-			ttlToUse = time.Duration(secs) * time.Second
-		}
-	}
-
-	cacheKey := c.Method() + ":" + c.OriginalURL()
-	if CacheInstance != nil && ttlToUse > 0 && cacheableMethod {
-		if data, ok, err := CacheInstance.Get(c.UserContext(), cacheKey); err == nil && ok {
-			var cached cachedHTTPResponse
-			if err := json.Unmarshal(data, &cached); err == nil && cached.Status != 0 {
-				if len(cached.Headers) > 0 {
-					for k, v := range cached.Headers {
-						c.Set(k, v)
-					}
-				}
-				c.Status(cached.Status)
-				logReq("[waiterd][cache] hit key=%s path=%s svc=%s status=%d", cacheKey, c.Path(), svc.Name, cached.Status)
-				return c.SendStream(bytes.NewReader(cached.Body))
-			}
-
-			// Backward compatibility: old cache entries were raw body.
-			logReq("[waiterd][cache] hit(key=%s) legacy-body path=%s svc=%s", cacheKey, c.Path(), svc.Name)
-			return c.SendStream(bytes.NewReader(data))
-		}
-	}
+	windows := endpointCacheWindows(ep.CacheTTL, ep.CacheStaleWhileRevalidate, ep.CacheStaleIfError)
+	ttlToUse := windows.ttl
 
 	timeout := serviceTimeout(svc)
 	base, err := parseBaseURL(svc.ProxyURL)
@@ -62,61 +38,272 @@ func proxyHTTP(c *fiber.Ctx, svc config.Service, ep config.Endpoint) error {
 
 	method := ep.Backend.Method
 	if method == "" {
-		method = c.Method()
+		method = strings.Clone(c.Method())
 	}
 
 	target := *base
 	target.Path = singleJoinPath(base.Path, ep.Backend.Path)
-	target.RawQuery = rawQueryFromOriginal(c.OriginalURL())
+	// method и query — копии: фоновая ревалидация переживает запрос, а буфер fasthttp переиспользуется
+	target.RawQuery = strings.Clone(rawQueryFromOriginal(c.OriginalURL()))
+
+	var cacheKey string
+	keyOK := false
+	if cacheableMethod {
+		var keyErr error
+		cacheKey, keyErr = cacheKeyFor(c, ep)
+		keyOK = keyErr == nil
+		if keyErr != nil && ttlToUse > 0 {
+			logReq("[waiterd][cache] skip path=%s: %v", c.Path(), keyErr)
+		}
+	}
+	if ep.Backend != nil && ep.Backend.Split != nil {
+		// варианты canary кэшируются раздельно
+		cacheKey += "|svc=" + svc.Name
+	}
+
+	// cache_mode: http — свежесть задаёт upstream (Cache-Control/Expires), cache_ttl лишь эвристика;
+	// запрос с Cache-Control: no-cache/no-store идёт мимо кэша.
+	httpMode := httpCacheMode(ep)
+	reqHeader := func(k string) string { return c.Get(k) }
+	cacheOn := CacheInstance != nil && cacheableMethod && keyOK && (ttlToUse > 0 || httpMode)
+	lookup, store := true, true
+	if httpMode {
+		lookup, store = requestCacheDirectives(reqHeader)
+	}
+	if isWarmup(c) {
+		lookup = false
+	}
+	cacheStore := proxyCacheStore{
+		key:       cacheKey,
+		windows:   windows,
+		httpMode:  httpMode,
+		hasAuth:   c.Get(fiber.HeaderAuthorization) != "",
+		reqHeader: reqHeader,
+		tags:      cacheTags(c, ep, c.AllParams()),
+	}
+
+	// stale — устаревшая запись, которую можно отдать, если upstream упадёт (stale-if-error);
+	// revalidate — запись, которую достаточно подтвердить условным запросом (304).
+	var stale, revalidate *cachedHTTPResponse
+	// share — ответ, который лидер склейки отдаёт ожидающим в этом процессе.
+	var share *fillResult
+	sharing := false
+	if cacheOn && lookup {
+		entry, state := lookupCached(c.UserContext(), cacheKey, windows, reqHeader)
+		switch state {
+		case cacheFresh:
+			logReq("[waiterd][cache] hit key=%s path=%s svc=%s status=%d", cacheKey, c.Path(), svc.Name, entry.Status)
+			return writeCachedResponse(c, entry, "")
+		case cacheStaleRevalidate:
+			logReq("[waiterd][cache] stale key=%s svc=%s, revalidating", cacheKey, svc.Name)
+			var bgBody io.Reader
+			if bodyKeyed(ep, c.Method()) {
+				// тело уже в буфере (bodyHash); копия — фоновый запрос переживёт c
+				bgBody = bytes.NewReader(bytes.Clone(c.Body()))
+			}
+			if req, err := http.NewRequest(method, target.String(), bgBody); err == nil {
+				copyHeaders(c, req)
+				detachHeader(req.Header)
+				hdr := http.Header(c.GetReqHeaders())
+				detachHeader(hdr)
+				bg := cacheStore
+				bg.reqHeader = hdr.Get
+				client := clientFor(svc)
+				revalidateInBackground(c.UserContext(), cacheKey, timeout, logReq, func(ctx context.Context) error {
+					return bg.fetchAndSave(ctx, client, req, entry)
+				})
+			}
+			return writeCachedResponse(c, entry, warningStale)
+		case cacheStaleIfError:
+			stale = entry
+			revalidate = entry
+		case cacheExpired:
+			revalidate = entry
+		}
+
+		// Промах: одинаковые запросы ждут, пока первый сходит в upstream и заполнит кэш.
+		// Запросы с Cookie не склеиваются: ответ на них может быть личным, а Cookie в ключ по умолчанию не входит.
+		if c.Get(fiber.HeaderCookie) == "" {
+			leader, shared, release := coalesceFill(c.UserContext(), cacheKey)
+			defer func() { release(share) }()
+			sharing = leader && CoalesceTimeout > 0
+			if !leader {
+				if entry, ok := shared.forRequest(reqHeader); ok {
+					logReq("[waiterd][cache] coalesced key=%s status=%d", cacheKey, entry.Status)
+					return writeCacheEntry(c, entry, "COALESCED", shared.warning)
+				}
+				if entry, state := lookupCached(c.UserContext(), cacheKey, windows, reqHeader); state == cacheFresh {
+					logReq("[waiterd][cache] coalesced key=%s", cacheKey)
+					return writeCachedResponse(c, entry, "")
+				}
+			}
+		}
+	}
 
 	logReq("[waiterd][call] svc=%s target=%s method=%s", svc.Name, target.String(), method)
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	mirrored := shadow.start(c, method, ep.Backend.Path, target.RawQuery)
 
-	body := bytes.NewReader(c.Body())
-	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	// Для streaming-эндпоинтов таймаут сервиса ограничивает только ожидание заголовков,
+	// дальше поток живёт, пока его не закроет upstream или клиент.
+	reqCtx, reqCancel := requestContext(c, ep)
+	var ctx context.Context
+	var svcCancel context.CancelFunc
+	var headerTimer *time.Timer
+	if ep.Streaming {
+		ctx, svcCancel = context.WithCancel(reqCtx)
+		headerTimer = time.AfterFunc(timeout, svcCancel)
+	} else {
+		ctx, svcCancel = context.WithTimeout(reqCtx, timeout)
+	}
+	cancel := func() {
+		svcCancel()
+		reqCancel()
+	}
+
+	body, size := upstreamRequestBody(c)
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), mirrored.body(body, size))
 	if err != nil {
+		cancel()
+		mirrored.failed(err)
 		logReq("[waiterd] new backend request error: %v", err)
 		return c.Status(http.StatusInternalServerError).SendString("backend request build error")
 	}
+	req.ContentLength = size
 
 	copyHeaders(c, req)
+	if !ep.Streaming {
+		setDeadlineHeader(ctx, req.Header)
+	}
+	// валидаторы клиента gateway проверяет сам (sendWithValidators), upstream получает только свои
+	clearConditionals(req.Header)
+	if !hasValidators(revalidate) {
+		revalidate = nil
+	} else {
+		setValidators(req.Header, revalidate)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := clientFor(svc).Do(req)
+	if headerTimer != nil {
+		headerTimer.Stop()
+	}
 	if err != nil {
+		cancel()
+		mirrored.failed(err)
 		logReq("[waiterd] backend %s %s -> %s error: %v", method, target.String(), svc.Name, err)
+		if isBodyTooLarge(err) {
+			return sendBodyTooLarge(c)
+		}
+		if stale != nil {
+			logReq("[waiterd][cache] serving stale key=%s after upstream error", cacheKey)
+			share = newFillResult(stale, warningRevalidateFailed, reqHeader)
+			return writeCachedResponse(c, stale, warningRevalidateFailed)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return c.Status(http.StatusGatewayTimeout).SendString("backend timeout")
+		}
 		return c.Status(http.StatusBadGateway).SendString("backend unavailable")
 	}
-	defer resp.Body.Close()
+	if revalidate != nil && resp.StatusCode == http.StatusNotModified {
+		_ = resp.Body.Close()
+		cancel()
+		mirrored.failed(errors.New("answered from cache after revalidation"))
+		entry, vary, ok := cacheStore.refreshed(revalidate, resp)
+		if !ok {
+			entry = revalidate
+		} else if store {
+			cacheStore.save(c.UserContext(), entry, vary)
+		}
+		logReq("[waiterd][cache] revalidated key=%s svc=%s (304)", cacheKey, svc.Name)
+		share = newFillResult(entry, "", reqHeader)
+		return writeCacheEntry(c, entry, "REVALIDATED", "")
+	}
+	if stale != nil && resp.StatusCode >= 500 {
+		mirrored.failed(fmt.Errorf("upstream status %d", resp.StatusCode))
+		_ = resp.Body.Close()
+		cancel()
+		logReq("[waiterd][cache] serving stale key=%s after upstream status %d", cacheKey, resp.StatusCode)
+		share = newFillResult(stale, warningRevalidateFailed, reqHeader)
+		return writeCachedResponse(c, stale, warningRevalidateFailed)
+	}
+	resp.Body = mirrored.tee(resp)
+	respBody := &cancelOnClose{Reader: resp.Body, body: resp.Body, cancel: cancel}
 
 	copyRespHeaders(resp, c)
+	c.Status(resp.StatusCode)
+
+	if ep.Streaming {
+		// fasthttp пишет каждый прочитанный кусок отдельным chunk с flush,
+		// а при отключении клиента закрывает поток — это отменяет и upstream.
+		respBody.Reader = &noWriteDeadline{Reader: resp.Body, conn: c.Context().Conn()}
+		return sendUpstreamStream(c, respBody, -1)
+	}
 
-	bodyBytes, readErr := io.ReadAll(resp.Body)
+	if cacheOn {
+		c.Set(XCacheHeader, "MISS")
+	}
+
+	// Не кэшируемый ответ сразу отдаём потоком: без буферизации и с chunked, если длина неизвестна.
+	var cached *cachedHTTPResponse
+	var vary []string
+	ok := false
+	if cacheOn && store {
+		cached, vary, ok = cacheStore.entryFor(resp)
+	}
+	if !ok {
+		if sharing && shareableResponse(resp) {
+			var err error
+			share, err = sendShared(c, resp, respBody, reqHeader, logReq)
+			return err
+		}
+		return sendUpstreamStream(c, respBody, int(resp.ContentLength))
+	}
+
+	// Для кэша буферизуем, но не больше MaxCacheableBodySize.
+	bodyBytes, complete, readErr := readUpTo(resp.Body, maxCacheableBodySize())
 	if readErr != nil {
+		_ = respBody.Close()
 		logReq("[waiterd] read response error: %v", readErr)
 		return c.Status(http.StatusBadGateway).SendString("backend read error")
 	}
+	if !complete {
+		logReq("[waiterd][cache] skip key=%s: body exceeds %d bytes, streaming", cacheKey, maxCacheableBodySize())
+		respBody.Reader = io.MultiReader(bytes.NewReader(bodyBytes), resp.Body)
+		return sendUpstreamStream(c, respBody, int(resp.ContentLength))
+	}
+	_ = respBody.Close()
 
-	c.Status(resp.StatusCode)
-	if _, err := c.Write(bodyBytes); err != nil {
+	if err := sendWithValidators(c, resp.StatusCode, cached.Headers, bodyBytes); err != nil {
 		logReq("[waiterd] write response error: %v", err)
 	}
 
-	if CacheInstance != nil && ttlToUse > 0 && cacheableMethod && resp.StatusCode < 500 {
-		cached := cachedHTTPResponse{
-			Status:  resp.StatusCode,
-			Headers: extractCacheableHeaders(resp.Header),
-			Body:    bodyBytes,
-		}
-		if b, err := json.Marshal(cached); err == nil {
-			_ = CacheInstance.Set(c.UserContext(), cacheKey, b, ttlToUse)
-		}
-	}
+	cached.Body = bodyBytes
+	cacheStore.save(c.UserContext(), cached, vary)
+	share = newFillResult(cached, "", reqHeader)
 
 	return nil
 }
 
+// sendShared отдаёт некэшируемый, но общий ответ лидера склейки (5xx, ответ без нужных для кэша
+// заголовков) целиком, чтобы ожидающие получили его же, а не пошли в upstream; какие ответы
+// общие — решает shareableResponse. Тело больше cache.max_body_bytes идёт потоком без склейки.
+func sendShared(c *fiber.Ctx, resp *http.Response, respBody *cancelOnClose,
+	reqHeader func(string) string, logReq func(string, ...any)) (*fillResult, error) {
+	bodyBytes, complete, readErr := readUpTo(resp.Body, maxCacheableBodySize())
+	if readErr != nil {
+		_ = respBody.Close()
+		logReq("[waiterd] read response error: %v", readErr)
+		return nil, c.Status(http.StatusBadGateway).SendString("backend read error")
+	}
+	if !complete {
+		respBody.Reader = io.MultiReader(bytes.NewReader(bodyBytes), resp.Body)
+		return nil, sendUpstreamStream(c, respBody, int(resp.ContentLength))
+	}
+	_ = respBody.Close()
+	entry := newCachedResponse(resp.StatusCode, extractCacheableHeaders(resp.Header), bodyBytes, 0)
+	return newFillResult(entry, "", reqHeader), c.Send(bodyBytes)
+}
+
 func serviceTimeout(svc config.Service) time.Duration {
 	timeout := 5 * time.Second
 	if svc.Timeout != "" {
@@ -127,7 +314,29 @@ func serviceTimeout(svc config.Service) time.Duration {
 	return timeout
 }
 
+// unixSocketHost is the Host used for requests to unix socket upstreams.
+const unixSocketHost = "localhost"
+
+// unixSocketPath разбирает proxy_url вида unix:///run/svc.sock или unix:///run/svc.sock:/prefix
+// (как в nginx) на путь к сокету и необязательный префикс пути.
+func unixSocketPath(raw string) (socket, prefix string, ok bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(raw), "unix://")
+	if !ok {
+		return "", "", false
+	}
+	if i := strings.Index(rest, ":/"); i >= 0 {
+		return rest[:i], rest[i+1:], true
+	}
+	return rest, "", true
+}
+
 func parseBaseURL(raw string) (*url.URL, error) {
+	if socket, prefix, ok := unixSocketPath(raw); ok {
+		if socket == "" {
+			return nil, fmt.Errorf("empty unix socket path")
+		}
+		return &url.URL{Scheme: "http", Host: unixSocketHost, Path: prefix}, nil
+	}
 	baseURL := raw
 	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
 		baseURL = "http://" + baseURL
@@ -142,7 +351,7 @@ func rawQueryFromOriginal(original string) string {
 	return ""
 }
 
-// httpBackendHandler подбирает транспорт (пока только http) и делегирует в proxyHTTP.
+// httpBackendHandler подбирает транспорт (http или grpc) и делегирует в proxyHTTP/grpcBackendHandler.
 func httpBackendHandler(services map[string]config.Service, ep config.Endpoint) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		b := ep.Backend
@@ -150,7 +359,12 @@ func httpBackendHandler(services map[string]config.Service, ep config.Endpoint)
 			return c.Status(http.StatusInternalServerError).SendString("backend not configured")
 		}
 
-		svc, ok := services[b.Service]
+		name := b.Service
+		if b.Split != nil && len(b.Split.Targets) > 0 {
+			name = splitStateFor(ep).pick(c)
+		}
+
+		svc, ok := services[name]
 		if !ok {
 			return c.Status(http.StatusBadGateway).SendString("unknown backend service")
 		}
@@ -162,9 +376,9 @@ func httpBackendHandler(services map[string]config.Service, ep config.Endpoint)
 
 		switch transport {
 		case "grpc":
-			return grpcNotImplementedHandler(svc, ep)(c)
+			return grpcBackendHandler(svc, ep)(c)
 		default:
-			return proxyHTTP(c, svc, ep)
+			return proxyHTTP(c, svc, ep, mirrorFor(services, ep))
 		}
 	}
 }
@@ -3,8 +3,11 @@ package httpserver
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -103,3 +106,156 @@ func TestProxyHTTP_CachesResponse(t *testing.T) {
 		t.Fatalf("cache getCount not incremented")
 	}
 }
+
+func TestProxyHTTP_StreamsLargeBodiesWithoutCaching(t *testing.T) {
+	t.Cleanup(func() {
+		CacheInstance = nil
+		DefaultCacheTTL = 0
+		MaxCacheableBodySize = 1 << 20
+	})
+
+	payload := strings.Repeat("x", 64)
+	hits := int32(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		got, _ := io.ReadAll(r.Body)
+		w.Write(got)
+		w.Write([]byte(payload))
+	}))
+	t.Cleanup(srv.Close)
+
+	services := map[string]config.Service{
+		"svc": {Name: "svc", ProxyURL: srv.URL},
+	}
+	ep := config.Endpoint{Path: "/echo", Backend: &config.Backend{Service: "svc", Path: "/"}}
+
+	cache := &stubCache{}
+	CacheInstance = cache
+	DefaultCacheTTL = time.Minute
+	MaxCacheableBodySize = 16
+
+	app := fiber.New(fiber.Config{StreamRequestBody: true})
+	app.Get("/echo", makeEndpointHandler(services, ep))
+	app.Post("/echo", makeEndpointHandler(services, ep))
+
+	// response larger than MaxCacheableBodySize: streamed in full, not cached
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/echo", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("get err=%v status=%v", err, resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != payload {
+		t.Fatalf("body=%q want %q", string(body), payload)
+	}
+	if atomic.LoadInt32(&cache.setCount) != 0 {
+		t.Fatalf("cache setCount=%d want 0", cache.setCount)
+	}
+
+	// request body is forwarded upstream
+	resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("upload:")))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("post err=%v status=%v", err, resp.StatusCode)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	if string(body) != "upload:"+payload {
+		t.Fatalf("post body=%q", string(body))
+	}
+	if atomic.LoadInt32(&hits) != 2 {
+		t.Fatalf("backend hits=%d want 2", hits)
+	}
+}
+
+func TestProxyHTTP_StreamingEndpointOutlivesServiceTimeout(t *testing.T) {
+	t.Cleanup(func() {
+		CacheInstance = nil
+		DefaultCacheTTL = 0
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		f := w.(http.Flusher)
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			f.Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	services := map[string]config.Service{
+		"svc": {Name: "svc", ProxyURL: srv.URL, Timeout: "40ms"},
+	}
+	ep := config.Endpoint{Path: "/events", Streaming: true, CacheTTL: "1m", Backend: &config.Backend{Service: "svc", Path: "/"}}
+
+	cache := &stubCache{}
+	CacheInstance = cache
+	DefaultCacheTTL = time.Minute
+
+	app := fiber.New()
+	app.Get("/events", makeEndpointHandler(services, ep))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/events", nil), -1)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("err=%v status=%v", err, resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "data: 0\n\ndata: 1\n\ndata: 2\n\n" {
+		t.Fatalf("body=%q", string(body))
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content-type=%q", ct)
+	}
+	if atomic.LoadInt32(&cache.getCount) != 0 || atomic.LoadInt32(&cache.setCount) != 0 {
+		t.Fatalf("streaming endpoint must bypass cache: get=%d set=%d", cache.getCount, cache.setCount)
+	}
+}
+
+func TestProxyHTTP_StreamedBodyRespectsBodyLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		w.Write(got)
+	}))
+	t.Cleanup(srv.Close)
+
+	services := map[string]config.Service{
+		"svc": {Name: "svc", ProxyURL: srv.URL},
+	}
+	ep := config.Endpoint{Path: "/upload", Backend: &config.Backend{Service: "svc", Path: "/"}}
+
+	app := fiber.New(fiber.Config{StreamRequestBody: true, BodyLimit: 32})
+	app.Use(bodyLimitMiddleware)
+	app.Post("/upload", makeEndpointHandler(services, ep))
+
+	post := func(body string, chunked bool) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(body))
+		if chunked {
+			// неизвестная длина — лимит держит limitedBody, а не проверка Content-Length
+			req.ContentLength = -1
+			req.TransferEncoding = []string{"chunked"}
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(got)
+	}
+
+	small, large := strings.Repeat("s", 20), strings.Repeat("l", 64)
+	if status, body := post(small, false); status != http.StatusOK || body != small {
+		t.Fatalf("small: status=%d body=%q", status, body)
+	}
+	if status, body := post(small, true); status != http.StatusOK || body != small {
+		t.Fatalf("small chunked: status=%d body=%q", status, body)
+	}
+	if status, _ := post(large, false); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("large: status=%d want 413", status)
+	}
+	if status, _ := post(large, true); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("large chunked: status=%d want 413", status)
+	}
+}
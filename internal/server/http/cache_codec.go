@@ -0,0 +1,91 @@
+package httpserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// cacheCodec сжимает значения для Redis. Сжатое значение начинается с маркера
+// "\x00WZ" и буквы алгоритма; всё остальное (JSON записей) хранится как есть,
+// поэтому записи, сделанные до смены настройки, читаются и после неё.
+type cacheCodec struct {
+	algo     byte // 0 — не сжимать, 'g' — gzip, 'z' — zstd
+	minBytes int
+}
+
+const codecMarker = "\x00WZ"
+
+// maxDecompressedValue защищает от «бомб» при распаковке: больше кэш всё равно не пишет.
+func maxDecompressedValue() int64 { return 4*maxCacheableBodySize() + 1<<20 }
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(256<<20))
+)
+
+func newCacheCodec(compression string, minBytes int) (cacheCodec, error) {
+	switch strings.ToLower(strings.TrimSpace(compression)) {
+	case "", "none":
+		return cacheCodec{}, nil
+	case "gzip":
+		return cacheCodec{algo: 'g', minBytes: minBytes}, nil
+	case "zstd":
+		return cacheCodec{algo: 'z', minBytes: minBytes}, nil
+	default:
+		return cacheCodec{}, fmt.Errorf("unknown cache compression %q (gzip, zstd)", compression)
+	}
+}
+
+func (c cacheCodec) encode(data []byte) []byte {
+	if c.algo == 0 || len(data) < c.minBytes {
+		return data
+	}
+	var out []byte
+	switch c.algo {
+	case 'g':
+		var buf bytes.Buffer
+		buf.WriteString(codecMarker + "g")
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(data)
+		_ = zw.Close()
+		out = buf.Bytes()
+	case 'z':
+		out = zstdEncoder.EncodeAll(data, []byte(codecMarker+"z"))
+	}
+	if len(out) >= len(data) {
+		return data // несжимаемое — хранить как есть дешевле
+	}
+	return out
+}
+
+func (c cacheCodec) decode(data []byte) ([]byte, error) {
+	if len(data) < len(codecMarker)+1 || string(data[:len(codecMarker)]) != codecMarker {
+		return data, nil
+	}
+	payload := data[len(codecMarker)+1:]
+	limit := maxDecompressedValue()
+	switch data[len(codecMarker)] {
+	case 'g':
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		out, err := io.ReadAll(io.LimitReader(zr, limit+1))
+		if err == nil && int64(len(out)) > limit {
+			err = fmt.Errorf("cache value exceeds %d bytes after decompression", limit)
+		}
+		return out, err
+	case 'z':
+		out, err := zstdDecoder.DecodeAll(payload, nil)
+		if err == nil && int64(len(out)) > limit {
+			err = fmt.Errorf("cache value exceeds %d bytes after decompression", limit)
+		}
+		return out, err
+	}
+	return nil, fmt.Errorf("unknown cache value encoding %q", data[len(codecMarker)])
+}
@@ -2,69 +2,130 @@ package httpserver
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/redis/go-redis/v9"
 	"strconv"
 	"strings"
 	"time"
 
 	"waiterd/internal/config"
 	appcache "waiterd/pkg/cache"
+	appcfg "waiterd/pkg/cfg"
 )
 
 // SetupCache wires CacheInstance/DefaultCacheTTL based on gateway cache config.
 // Returns cleanup function (no-op if cache not enabled).
 func SetupCache(cfg config.Cache) (func(), error) {
 	DefaultCacheTTL = parseTTL(cfg.TTL)
+	if cfg.MaxBodyBytes > 0 {
+		MaxCacheableBodySize = cfg.MaxBodyBytes
+	}
+	if cfg.Mode != "" {
+		DefaultCacheMode = cfg.Mode
+	}
+	if v := strings.TrimSpace(cfg.CoalesceTimeout); v != "" {
+		CoalesceTimeout = parseTTL(v)
+	}
 
 	driver := strings.ToLower(strings.TrimSpace(cfg.Driver))
 	if driver == "memory" {
-		CacheInstance = newMemoryCacheAdapter()
-		return func() {}, nil
+		m := newBoundedMemoryCache(cfg.MaxEntries, cfg.MaxBytes, parseTTL(cfg.CleanupInterval))
+		CacheInstance = m
+		return m.Close, nil
 	}
-	if driver != "redis" {
+	if driver != "redis" && driver != "tiered" {
 		// disabled/unknown — leave CacheInstance nil
 		return func() {}, nil
 	}
 
-	cacheCfg := appcache.Config{
-		Addr:       fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Password:   cfg.Pass,
-		DB:         cfg.Db,
-		Prefix:     "waiterd",
-		DefaultTTL: int(DefaultCacheTTL.Seconds()),
+	cacheCfg, err := redisConfig(cfg)
+	if err != nil {
+		return nil, err
 	}
-
-	r, err := appcache.Init(context.Background(), cacheCfg)
+	r := appcache.NewRedis(cacheCfg)
+	codec, err := newCacheCodec(cfg.Compression, cfg.CompressMinBytes)
 	if err != nil {
-		return nil, fmt.Errorf("init redis cache: %w", err)
+		_ = r.Close()
+		return nil, err
+	}
+	prefix := cacheKeyPrefix(cfg.KeyPrefix, cfg.ConfigVersion)
+	l2 := &redisCacheAdapter{rdb: r.Client, prefix: prefix, codec: codec}
+	// Недоступный при старте Redis не мешает запуску: до его появления запросы идут мимо кэша.
+	if err := r.Ping(context.Background()); err != nil {
+		l2.observe(context.Background(), err)
 	}
 
-	CacheInstance = &redisCacheAdapter{rdb: r.Client}
+	if driver == "redis" {
+		CacheInstance = l2
+		return func() { _ = r.Close() }, nil
+	}
 
-	return func() { _ = r.Close() }, nil
-}
+	// tiered: L1 в памяти, L2 в Redis, L1 соседей сбрасывается через pub/sub
+	l1 := newBoundedMemoryCache(cfg.MaxEntries, cfg.MaxBytes, parseTTL(cfg.CleanupInterval))
+	l1TTL := parseTTL(cfg.L1TTL)
+	if l1TTL <= 0 {
+		l1TTL = 5 * time.Second
+	}
+	tc := newTieredCache(l1, l2, l1TTL, func(ctx context.Context, inv cacheInvalidation) error {
+		b, err := json.Marshal(inv)
+		if err != nil {
+			return err
+		}
+		return r.Client.Publish(ctx, prefix+tieredInvalidationChannel, b).Err()
+	})
+	ps := r.Client.Subscribe(context.Background(), prefix+tieredInvalidationChannel)
+	go tc.listen(ps)
+	CacheInstance = tc
 
-type redisCacheAdapter struct {
-	rdb *redis.Client
+	return func() {
+		_ = ps.Close()
+		l1.Close()
+		_ = r.Close()
+	}, nil
 }
 
-func (a *redisCacheAdapter) Get(ctx context.Context, key string) ([]byte, bool, error) {
-	b, err := a.rdb.Get(ctx, key).Bytes()
-	if err != nil {
-		if err == redis.Nil {
-			return nil, false, nil
+// redisConfig переводит секцию cache конфига в настройки клиента Redis.
+func redisConfig(cfg config.Cache) (appcache.Config, error) {
+	out := appcache.Config{
+		Addr:             fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Username:         cfg.Username,
+		Password:         cfg.Pass,
+		DB:               cfg.Db,
+		Prefix:           cacheKeyPrefix(cfg.KeyPrefix, cfg.ConfigVersion),
+		DefaultTTL:       int(DefaultCacheTTL.Seconds()),
+		Addrs:            cfg.Addrs,
+		Cluster:          cfg.Cluster,
+		MasterName:       cfg.MasterName,
+		SentinelUsername: cfg.SentinelUsername,
+		SentinelPassword: cfg.SentinelPassword,
+		PoolSize:         cfg.PoolSize,
+		MinIdleConns:     cfg.MinIdleConns,
+		DialTimeout:      parseTTL(cfg.DialTimeout),
+		ReadTimeout:      parseTTL(cfg.ReadTimeout),
+		WriteTimeout:     parseTTL(cfg.WriteTimeout),
+		PoolTimeout:      parseTTL(cfg.PoolTimeout),
+	}
+	if cfg.TLS != nil || cfg.TLSEnabled {
+		tlsCfg := &config.ClientTLS{}
+		if cfg.TLS != nil {
+			tlsCfg = cfg.TLS
+		}
+		t, err := clientTLSConfig(tlsCfg)
+		if err != nil {
+			return out, fmt.Errorf("cache tls: %w", err)
 		}
-		return nil, false, err
+		out.TLS = t
 	}
-	return b, true, nil
+	return out, nil
 }
 
-func (a *redisCacheAdapter) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
-	if ttl <= 0 {
-		ttl = DefaultCacheTTL
+// cacheKeyPrefix раскрывает {env} (APP_ENV) и {version} в cache.key_prefix и добавляет ":".
+func cacheKeyPrefix(tmpl, version string) string {
+	p := strings.NewReplacer("{env}", appcfg.String("APP_ENV", "dev"), "{version}", version).Replace(strings.TrimSpace(tmpl))
+	if p != "" && !strings.HasSuffix(p, ":") {
+		p += ":"
 	}
-	return a.rdb.Set(ctx, key, data, ttl).Err()
+	return p
 }
 
 func parseTTL(val string) time.Duration {
@@ -16,3 +16,11 @@ var CacheInstance cacheInterface
 
 // DefaultCacheTTL is used for aggregate endpoints when not specified.
 var DefaultCacheTTL = 0 * time.Second
+
+// MaxCacheableBodySize bounds how much of an upstream response is buffered for caching.
+// Larger responses are streamed to the client and never cached.
+var MaxCacheableBodySize int64 = 1 << 20
+
+// CoalesceTimeout bounds how long identical requests wait for the one that fills the cache.
+// Zero disables request coalescing.
+var CoalesceTimeout = 5 * time.Second
@@ -1,7 +1,12 @@
 package httpserver
 
 import (
+	"encoding/json"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
 )
 
 // cachedHTTPResponse is what we store in cache for proxied responses.
@@ -12,6 +17,14 @@ type cachedHTTPResponse struct {
 	Status  int               `json:"status"`
 	Headers map[string]string `json:"headers,omitempty"`
 	Body    []byte            `json:"body"`
+
+	// StoredAt/FreshFor задают окно свежести; у старых записей их нет — такие записи всегда свежие.
+	StoredAt time.Time     `json:"stored_at,omitzero"`
+	FreshFor time.Duration `json:"fresh_for,omitempty"`
+
+	// VaryOn помечает запись-указатель: ответ зависит от этих заголовков запроса
+	// и лежит под variantKey (cache_mode: http).
+	VaryOn []string `json:"vary_on,omitempty"`
 }
 
 var cachedHeaderAllowList = map[string]struct{}{
@@ -24,19 +37,137 @@ var cachedHeaderAllowList = map[string]struct{}{
 	// Note: do not cache Set-Cookie by default.
 }
 
+// extractCacheableHeaders keeps allow-listed headers under their canonical names
+// (http.Header spells ETag as "Etag").
 func extractCacheableHeaders(h http.Header) map[string]string {
 	out := make(map[string]string)
-	for k, vals := range h {
-		if _, ok := cachedHeaderAllowList[k]; !ok {
-			continue
+	for name := range cachedHeaderAllowList {
+		k := http.CanonicalHeaderKey(name)
+		if v := h.Get(k); v != "" {
+			out[k] = v
 		}
-		if len(vals) == 0 {
-			continue
-		}
-		out[k] = vals[0]
 	}
 	if len(out) == 0 {
 		return nil
 	}
 	return out
 }
+
+// decodeCachedResponse разбирает запись кэша. Старые записи (сырое тело proxy или JSON агрегата)
+// превращаются в ответ 200.
+func decodeCachedResponse(data []byte) *cachedHTTPResponse {
+	var cached cachedHTTPResponse
+	if err := json.Unmarshal(data, &cached); err == nil && (cached.Status != 0 || len(cached.VaryOn) > 0) {
+		return &cached
+	}
+	legacy := &cachedHTTPResponse{Status: http.StatusOK, Body: data}
+	if json.Valid(data) {
+		legacy.Headers = map[string]string{fiber.HeaderContentType: fiber.MIMEApplicationJSON}
+	}
+	return legacy
+}
+
+func (r *cachedHTTPResponse) age(now time.Time) time.Duration {
+	if r.StoredAt.IsZero() {
+		return 0
+	}
+	return max(now.Sub(r.StoredAt), 0)
+}
+
+// cacheWindows — окна жизни записи: свежая (ttl), затем stale-while-revalidate и stale-if-error,
+// отсчитываемые от конца свежести.
+type cacheWindows struct {
+	ttl, swr, sie time.Duration
+}
+
+func endpointCacheWindows(ttl, swr, sie string) cacheWindows {
+	w := cacheWindows{ttl: DefaultCacheTTL, swr: parseTTL(swr), sie: parseTTL(sie)}
+	if ttl != "" {
+		w.ttl = parseTTL(ttl)
+	}
+	return w
+}
+
+// storeTTL is how long the entry has to stay in the cache driver to cover every window.
+func (w cacheWindows) storeTTL() time.Duration {
+	return w.ttl + max(w.swr, w.sie)
+}
+
+// cacheState — чем является найденная запись для текущего запроса.
+type cacheState int
+
+const (
+	cacheMiss cacheState = iota
+	cacheFresh
+	cacheStaleRevalidate // можно отдать сразу и обновить в фоне
+	cacheStaleIfError    // можно отдать, только если upstream упал
+	cacheExpired         // отдавать нельзя, но можно ревалидировать по ETag/Last-Modified
+)
+
+func (w cacheWindows) classify(r *cachedHTTPResponse, now time.Time) cacheState {
+	if r == nil {
+		return cacheMiss
+	}
+	if r.StoredAt.IsZero() {
+		return cacheFresh
+	}
+	freshFor := r.FreshFor
+	if freshFor <= 0 {
+		freshFor = w.ttl
+	}
+	age := r.age(now)
+	switch {
+	case age < freshFor:
+		return cacheFresh
+	case age < freshFor+w.swr:
+		return cacheStaleRevalidate
+	case age < freshFor+w.sie:
+		return cacheStaleIfError
+	}
+	return cacheExpired
+}
+
+// newCachedResponse builds an entry that is fresh for ttl from now.
+func newCachedResponse(status int, headers map[string]string, body []byte, ttl time.Duration) *cachedHTTPResponse {
+	return &cachedHTTPResponse{Status: status, Headers: headers, Body: body, StoredAt: time.Now(), FreshFor: ttl}
+}
+
+// Значения заголовка Warning (RFC 7234) для устаревших ответов.
+const (
+	warningStale            = `110 - "Response is Stale"`
+	warningRevalidateFailed = `111 - "Revalidation Failed"`
+)
+
+// writeCachedResponse отдаёт запись кэша; warning непустой для устаревших ответов.
+func writeCachedResponse(c *fiber.Ctx, r *cachedHTTPResponse, warning string) error {
+	xcache := "HIT"
+	if warning != "" {
+		xcache = "STALE"
+	}
+	return writeCacheEntry(c, r, xcache, warning)
+}
+
+func writeCacheEntry(c *fiber.Ctx, r *cachedHTTPResponse, xcache, warning string) error {
+	for k, v := range r.Headers {
+		c.Set(k, v)
+	}
+	if !r.StoredAt.IsZero() {
+		c.Set(fiber.HeaderAge, strconv.Itoa(int(r.age(time.Now()).Seconds())))
+	}
+	if warning != "" {
+		c.Set(fiber.HeaderWarning, warning)
+	}
+	c.Set(XCacheHeader, xcache)
+	return sendWithValidators(c, r.Status, r.Headers, r.Body)
+}
+
+// sendWithValidators отвечает 304 без тела, если валидаторы клиента совпали с ETag/Last-Modified ответа.
+func sendWithValidators(c *fiber.Ctx, status int, headers map[string]string, body []byte) error {
+	if status == http.StatusOK && (c.Method() == http.MethodGet || c.Method() == http.MethodHead) && notModified(c, headers) {
+		c.Response().Header.Del(fiber.HeaderContentType)
+		c.Status(http.StatusNotModified)
+		return nil
+	}
+	c.Status(status)
+	return c.Send(body)
+}
@@ -0,0 +1,206 @@
+package httpserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+// methodQuery — HTTP QUERY (безопасный метод с телом); POST и QUERY кэшируются только с cache_key.body.
+const methodQuery = "QUERY"
+
+// defaultMaxKeyBodyBytes — cache_key.max_body_bytes по умолчанию.
+const defaultMaxKeyBodyBytes = 64 << 10
+
+// Причины, по которым запрос не кэшируется (cacheKeyFor).
+var (
+	errCacheKeyAuth = errors.New("Authorization or Cookie not covered by cache_key policy")
+	errCacheKeyBody = errors.New("request body too large or of unknown length")
+)
+
+// cacheKeyFor строит ключ кэша по политике endpoint (cache_key).
+// Ошибка — запрос кэшировать нельзя: его Authorization или Cookie политика ключа не учитывает
+// (ответ одного пользователя достался бы другому), или тело не годится для ключа.
+func cacheKeyFor(c *fiber.Ctx, ep config.Endpoint) (string, error) {
+	policy := ep.CacheKey
+	if !credentialsKeyed(c, policy) {
+		return "", errCacheKeyAuth
+	}
+	if policy == nil {
+		return c.Method() + ":" + c.OriginalURL(), nil
+	}
+
+	path, rawQuery, _ := strings.Cut(c.OriginalURL(), "?")
+	base := c.Method() + ":" + path
+
+	var b strings.Builder
+	b.WriteString(base)
+	if q := normalizeQuery(rawQuery, policy); q != "" {
+		b.WriteString("?" + q)
+	}
+	b.WriteString(requestKeyParts(c, policy))
+
+	if bodyKeyed(ep, c.Method()) {
+		sum, ok := bodyHash(c, policy.MaxBodyBytes)
+		if !ok {
+			return "", errCacheKeyBody
+		}
+		b.WriteString("|b:" + sum)
+	}
+
+	return limitKeyLength(b.String(), base, policy.MaxLength), nil
+}
+
+// credentialsKeyed — учтены ли учётные данные запроса политикой ключа. Authorization: политика задана
+// (пустой cache_key: {} явно разрешает общий кэш). Cookie: cookies перечислены или ignore_cookies.
+func credentialsKeyed(c *fiber.Ctx, policy *config.CacheKey) bool {
+	if policy == nil {
+		return c.Get(fiber.HeaderAuthorization) == "" && c.Get(fiber.HeaderCookie) == ""
+	}
+	return c.Get(fiber.HeaderCookie) == "" || len(policy.Cookies) > 0 || policy.IgnoreCookies
+}
+
+// requestKeyParts — часть ключа из заголовков, claims и cookies запроса: |h:..|c:..|a:..|k:..
+// Подпись JWT шлюз не проверяет, поэтому при claims в ключ входит ещё и sha256 всего Authorization:
+// поддельный токен с чужим sub получает свою запись (промах), а не ответ владельца sub.
+func requestKeyParts(c *fiber.Ctx, policy *config.CacheKey) string {
+	var b strings.Builder
+	for _, h := range policy.Headers {
+		b.WriteString("|h:" + h + "=" + url.QueryEscape(c.Get(h)))
+	}
+	if len(policy.Claims) > 0 {
+		claims := jwtClaims(c)
+		for _, name := range policy.Claims {
+			var v string
+			if raw, found := claims[name]; found {
+				v = fmt.Sprint(raw)
+			}
+			b.WriteString("|c:" + name + "=" + url.QueryEscape(v))
+		}
+		sum := sha256.Sum256([]byte(c.Get(fiber.HeaderAuthorization)))
+		b.WriteString("|a:" + hex.EncodeToString(sum[:]))
+	}
+	for _, name := range policy.Cookies {
+		b.WriteString("|k:" + name + "=" + url.QueryEscape(c.Cookies(name)))
+	}
+	return b.String()
+}
+
+// limitKeyLength заменяет ключ длиннее maxLength на base#sha256(ключа); 0 — без ограничения.
+func limitKeyLength(key, base string, maxLength int) string {
+	if maxLength > 0 && len(key) > maxLength {
+		sum := sha256.Sum256([]byte(key))
+		return base + "#" + hex.EncodeToString(sum[:])
+	}
+	return key
+}
+
+// bodyKeyed — тело запроса входит в ключ: POST/QUERY на endpoint с cache_key.body.
+func bodyKeyed(ep config.Endpoint, method string) bool {
+	return ep.CacheKey != nil && ep.CacheKey.Body && (method == http.MethodPost || method == methodQuery)
+}
+
+// bodyHash — sha256 media type и тела запроса. JSON канонизируется (ключи объектов по порядку,
+// без пробелов), так что {"a":1,"b":2} и { "b": 2, "a": 1 } дают один ключ.
+// ok=false — тело больше limit или его длина неизвестна (chunked): такие запросы не кэшируются.
+func bodyHash(c *fiber.Ctx, limit int64) (string, bool) {
+	if limit <= 0 {
+		limit = defaultMaxKeyBodyBytes
+	}
+	var body []byte
+	if cl := c.Request().Header.ContentLength(); cl != 0 {
+		if cl < 0 || int64(cl) > limit {
+			return "", false
+		}
+		// c.Body() дочитывает поток в память; proxyHTTP затем возьмёт тело из буфера
+		body = c.Body()
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	if isJSONMediaType(mediaType) {
+		if canon, err := canonicalJSON(body); err == nil {
+			body = canon
+		}
+	}
+	h := sha256.New()
+	h.Write([]byte(mediaType))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == fiber.MIMEApplicationJSON || strings.HasSuffix(mediaType, "+json")
+}
+
+// canonicalJSON перекодирует JSON: encoding/json пишет ключи map отсортированными,
+// а json.Number сохраняет числа как есть (1.0 и 1 остаются разными, как и для backend).
+func canonicalJSON(body []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("trailing data after JSON value")
+	}
+	return json.Marshal(v)
+}
+
+// normalizeQuery выбрасывает/оставляет параметры по политике; порядок сохраняется, если не SortQuery.
+func normalizeQuery(rawQuery string, policy *config.CacheKey) string {
+	if rawQuery == "" {
+		return ""
+	}
+	if len(policy.QueryInclude) == 0 && len(policy.QueryIgnore) == 0 && !policy.SortQuery {
+		return rawQuery
+	}
+	var kept []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		rawName, _, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+		if len(policy.QueryInclude) > 0 && !matchQueryParam(policy.QueryInclude, name) {
+			continue
+		}
+		if matchQueryParam(policy.QueryIgnore, name) {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	if policy.SortQuery {
+		slices.Sort(kept)
+	}
+	return strings.Join(kept, "&")
+}
+
+func matchQueryParam(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if p == name {
+			return true
+		}
+	}
+	return false
+}
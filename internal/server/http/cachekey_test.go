@@ -0,0 +1,205 @@
+package httpserver
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+func testJWT(payload string) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	return "Bearer " + enc([]byte(`{"alg":"none"}`)) + "." + enc([]byte(payload)) + ".sig"
+}
+
+func TestCacheKeyFor(t *testing.T) {
+	token := testJWT(`{"sub":"u 1"}`)
+	tokenSum := sha256.Sum256([]byte(token))
+	cases := []struct {
+		name    string
+		policy  *config.CacheKey
+		target  string
+		headers map[string]string
+		want    string
+		ok      bool
+	}{
+		{"default", nil, "/a?b=1", nil, "GET:/a?b=1", true},
+		{"auth without policy", nil, "/a", map[string]string{"Authorization": "Bearer x"}, "", false},
+		{"cookie without policy", nil, "/a", map[string]string{"Cookie": "session=s1"}, "", false},
+		{"cookie not in policy", &config.CacheKey{Headers: []string{"X-Tenant"}}, "/a", map[string]string{"Cookie": "session=s1"}, "", false},
+		{"cookie listed", &config.CacheKey{Cookies: []string{"session"}}, "/a", map[string]string{"Cookie": "session=s1; _ga=1"}, "GET:/a|k:session=s1", true},
+		{"cookies ignored", &config.CacheKey{IgnoreCookies: true}, "/a", map[string]string{"Cookie": "_ga=1"}, "GET:/a", true},
+		{"sort and ignore", &config.CacheKey{SortQuery: true, QueryIgnore: []string{"utm_*"}},
+			"/a?z=1&utm_source=x&a=2", nil, "GET:/a?a=2&z=1", true},
+		{"include only", &config.CacheKey{QueryInclude: []string{"page"}}, "/a?page=2&sid=9", nil, "GET:/a?page=2", true},
+		{"header, claim, cookie", &config.CacheKey{Headers: []string{"X-Tenant"}, Claims: []string{"sub"}, Cookies: []string{"lang"}},
+			"/a", map[string]string{"X-Tenant": "t1", "Authorization": token, "Cookie": "lang=ru"},
+			"GET:/a|h:X-Tenant=t1|c:sub=u+1|a:" + hex.EncodeToString(tokenSum[:]) + "|k:lang=ru", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			app := fiber.New()
+			var key string
+			var err error
+			app.Get("/a", func(c *fiber.Ctx) error {
+				key, err = cacheKeyFor(c, config.Endpoint{CacheKey: tc.policy})
+				return nil
+			})
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			if _, testErr := app.Test(req); testErr != nil {
+				t.Fatal(testErr)
+			}
+			if key != tc.want || (err == nil) != tc.ok {
+				t.Fatalf("key=%q err=%v, want %q ok=%v", key, err, tc.want, tc.ok)
+			}
+		})
+	}
+
+	t.Run("hashed", func(t *testing.T) {
+		app := fiber.New()
+		var key string
+		app.Get("/a", func(c *fiber.Ctx) error {
+			key, _ = cacheKeyFor(c, config.Endpoint{CacheKey: &config.CacheKey{MaxLength: 32}})
+			return nil
+		})
+		if _, err := app.Test(httptest.NewRequest(http.MethodGet, "/a?q="+strings.Repeat("x", 100), nil)); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(key, "GET:/a#") || len(key) != len("GET:/a#")+64 {
+			t.Fatalf("hashed key=%q", key)
+		}
+	})
+}
+
+func TestProxyHTTP_CacheKeyPolicy(t *testing.T) {
+	t.Cleanup(func() { CacheInstance = nil })
+	CacheInstance = newMemoryCacheAdapter()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	t.Cleanup(srv.Close)
+
+	services := indexServices([]config.Service{{Name: "svc", ProxyURL: srv.URL}})
+	app := fiber.New()
+	app.Get("/shared", makeEndpointHandler(services, config.Endpoint{
+		Path: "/shared", CacheTTL: "1m",
+		Backend: &config.Backend{Service: "svc", Path: "/"},
+	}))
+	app.Get("/per-user", makeEndpointHandler(services, config.Endpoint{
+		Path: "/per-user", CacheTTL: "1m", CacheKey: &config.CacheKey{Claims: []string{"sub"}},
+		Backend: &config.Backend{Service: "svc", Path: "/"},
+	}))
+
+	get := func(path, auth string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", auth)
+		resp, err := app.Test(req, 2000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	alice, bob := testJWT(`{"sub":"alice"}`), testJWT(`{"sub":"bob"}`)
+
+	// без cache_key ответ с Authorization не кэшируется и не утекает другому пользователю
+	get("/shared", alice)
+	if body := get("/shared", bob); body != bob {
+		t.Fatalf("/shared served %q to bob", body)
+	}
+
+	get("/per-user", alice)
+	if body := get("/per-user", bob); body != bob {
+		t.Fatalf("/per-user served %q to bob", body)
+	}
+	if body := get("/per-user", alice); body != alice {
+		t.Fatalf("/per-user wrong body for alice: %q", body)
+	}
+
+	// подпись не проверяется: токен alg=none с тем же sub не должен получить ответ alice из кэша
+	forged := testJWT(`{"sub":"alice","forged":true}`)
+	if body := get("/per-user", forged); body != forged {
+		t.Fatalf("forged token with alice's sub served %q from cache", body)
+	}
+	if body := get("/per-user", alice+"-other-signature"); body != alice+"-other-signature" {
+		t.Fatalf("token with foreign signature served %q from cache", body)
+	}
+}
+
+func TestProxyHTTP_BodyKeyedCache(t *testing.T) {
+	t.Cleanup(func() { CacheInstance = nil })
+	CacheInstance = newMemoryCacheAdapter()
+
+	hits := int32(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		b, _ := io.ReadAll(r.Body)
+		w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+
+	services := indexServices([]config.Service{{Name: "svc", ProxyURL: srv.URL}})
+	app := fiber.New(fiber.Config{RequestMethods: requestMethods})
+	search := config.Endpoint{
+		Path: "/search", CacheTTL: "1m", CacheKey: &config.CacheKey{Body: true, MaxBodyBytes: 64},
+		Backend: &config.Backend{Service: "svc", Path: "/"},
+	}
+	app.Post("/search", makeEndpointHandler(services, search))
+	app.Add(methodQuery, "/search", makeEndpointHandler(services, search))
+	app.Post("/plain", makeEndpointHandler(services, config.Endpoint{
+		Path: "/plain", CacheTTL: "1m", Backend: &config.Backend{Service: "svc", Path: "/"},
+	}))
+
+	send := func(method, path, body string) string {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, 2000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	// порядок полей и пробелы не влияют на ключ, upstream получает тело как есть
+	if got := send(http.MethodPost, "/search", `{"q":"go","page":1}`); got != `{"q":"go","page":1}` {
+		t.Fatalf("upstream echoed %q", got)
+	}
+	if got := send(http.MethodPost, "/search", `{ "page": 1, "q": "go" }`); got != `{"q":"go","page":1}` || atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("want cache hit, got %q hits=%d", got, hits)
+	}
+	// другое тело и другой метод — разные записи
+	send(http.MethodPost, "/search", `{"q":"rust","page":1}`)
+	send(methodQuery, "/search", `{"q":"go","page":1}`)
+	if atomic.LoadInt32(&hits) != 3 {
+		t.Fatalf("hits=%d, want 3", hits)
+	}
+	// тело больше max_body_bytes не кэшируется
+	big := `{"q":"` + strings.Repeat("x", 100) + `"}`
+	send(http.MethodPost, "/search", big)
+	if got := send(http.MethodPost, "/search", big); got != big || atomic.LoadInt32(&hits) != 5 {
+		t.Fatalf("large body: got %q hits=%d", got, hits)
+	}
+	// без cache_key.body POST не кэшируется вовсе
+	send(http.MethodPost, "/plain", `{}`)
+	send(http.MethodPost, "/plain", `{}`)
+	if atomic.LoadInt32(&hits) != 7 {
+		t.Fatalf("/plain hits=%d, want 7", hits)
+	}
+}
@@ -0,0 +1,121 @@
+package httpserver
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+// callCachePrefix — начало ключей вызовов агрегации: call:<svc>:<METHOD>:<path>?query|...
+// С ключами endpoint (METHOD:path) они не пересекаются; сбросить все вызовы сервиса — pattern "call:<svc>:*".
+const callCachePrefix = "call:"
+
+// callCache — запись кэша одного вызова агрегации (calls[].cache_ttl).
+type callCache struct {
+	key     string
+	ttl     time.Duration
+	tags    []string
+	refresh bool // не читать кэш, только перезаписать (прогрев)
+}
+
+// callKeyParts снимает с запроса клиента части ключей кэшируемых calls (requestKeyParts),
+// пока fiber.Ctx ещё доступен. Вызова нет в map — он не кэшируется: Authorization или Cookie
+// запроса cache_key вызова не учитывает (credentialsKeyed).
+func callKeyParts(c *fiber.Ctx, ep config.Endpoint) map[string]string {
+	var parts map[string]string
+	for _, call := range ep.Calls {
+		if parseTTL(call.CacheTTL) <= 0 {
+			continue
+		}
+		if !credentialsKeyed(c, call.CacheKey) {
+			continue
+		}
+		if parts == nil {
+			parts = make(map[string]string)
+		}
+		if call.CacheKey != nil {
+			parts[call.Name] = requestKeyParts(c, call.CacheKey)
+		} else {
+			parts[call.Name] = ""
+		}
+	}
+	return parts
+}
+
+// callCacheFor строит ключ вызова. path — путь запроса к сервису; для gRPC это метод,
+// поэтому в ключ добавляются и параметры маршрута (из них собирается сообщение).
+func (in aggregateInput) callCacheFor(call config.AggCall, svc config.Service, method, path string, grpc bool) (callCache, bool) {
+	part, ok := in.callKeys[call.Name]
+	if !ok || CacheInstance == nil {
+		return callCache{}, false
+	}
+	policy := call.CacheKey
+	if policy == nil {
+		policy = &config.CacheKey{}
+	}
+
+	base := callCachePrefix + svc.Name + ":" + method + ":" + path
+	key := base
+	if q := normalizeQuery(in.rawQuery, policy); q != "" {
+		key += "?" + q
+	}
+	if grpc && len(in.params) > 0 {
+		params := url.Values{}
+		for k, v := range in.params {
+			params.Set(k, v)
+		}
+		key += "|p:" + params.Encode()
+	}
+	key += part
+
+	var tags []string
+	for _, t := range call.CacheTags {
+		if tag, ok := expandTemplate(t, in.params); ok {
+			tags = append(tags, tag)
+		}
+	}
+	return callCache{
+		key:     limitKeyLength(key, base, policy.MaxLength),
+		ttl:     parseTTL(call.CacheTTL),
+		tags:    tags,
+		refresh: in.refresh,
+	}, true
+}
+
+// do отдаёт ответ вызова из кэша или выполняет fetch и кэширует успешный (2xx) ответ.
+// Одинаковые вызовы разных агрегаций склеиваются так же, как запросы к endpoint:
+// ожидающие получают ответ лидера, каким бы он ни был.
+func (cc callCache) do(ctx context.Context, fetch func() ([]byte, int, error)) (body []byte, status int, hit bool, err error) {
+	var share *fillResult
+	if !cc.refresh {
+		w := cacheWindows{ttl: cc.ttl}
+		if entry, state := lookupCached(ctx, cc.key, w, nil); state == cacheFresh {
+			return entry.Body, entry.Status, true, nil
+		}
+		leader, shared, release := coalesceFill(ctx, cc.key)
+		defer func() { release(share) }()
+		if !leader {
+			if entry, ok := shared.forRequest(nil); ok {
+				return entry.Body, entry.Status, false, nil
+			}
+			if entry, state := lookupCached(ctx, cc.key, w, nil); state == cacheFresh {
+				return entry.Body, entry.Status, true, nil
+			}
+		}
+	}
+
+	body, status, err = fetch()
+	if err == nil {
+		// ошибки и не-2xx в кэш не пишутся, но одновременным таким же вызовам отдаются
+		share = newFillResult(newCachedResponse(status, nil, body, 0), "", nil)
+	}
+	if err == nil && status >= 200 && status < 300 {
+		storeCachedResponse(ctx, cc.key, newCachedResponse(status, nil, body, cc.ttl), cc.ttl)
+		tagCached(ctx, cc.key, cc.tags, cc.ttl)
+	}
+	return body, status, false, err
+}
@@ -0,0 +1,158 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// cacheLocker is implemented by shared cache drivers (Redis) so that only one gateway
+// instance in the cluster fills a given cache key at a time.
+type cacheLocker interface {
+	// TryLock takes key for at most ttl; ok=false means another holder has it.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(), ok bool, err error)
+	// Locked reports whether key is still held.
+	Locked(ctx context.Context, key string) (bool, error)
+}
+
+// fills tracks cache keys currently being filled by this process.
+var fills sync.Map // cache key -> *fillFlight
+
+type fillFlight struct {
+	done   chan struct{}
+	result *fillResult // записывается лидером до close(done)
+}
+
+// fillResult — ответ лидера для ожидающих в этом процессе. Его получают и те ответы,
+// которые в кэш не попадают (5xx, 4xx вызова; личные — нет, см. shareableResponse), поэтому ожидающие не идут в upstream.
+type fillResult struct {
+	entry   *cachedHTTPResponse
+	warning string
+	// vary — заголовки запроса лидера из Vary ответа: ожидающему с другими значениями ответ не подходит.
+	vary map[string]string
+}
+
+// newFillResult готовит ответ лидера для ожидающих; header — заголовки запроса лидера.
+// 304 делиться нельзя: он ответ на валидаторы самого лидера.
+func newFillResult(entry *cachedHTTPResponse, warning string, header func(string) string) *fillResult {
+	if entry == nil || entry.Status == http.StatusNotModified {
+		return nil
+	}
+	r := &fillResult{entry: entry, warning: warning}
+	if v := entry.Headers["Vary"]; v != "" {
+		names := varyNames(http.Header{"Vary": {v}})
+		r.vary = make(map[string]string, len(names))
+		for _, n := range names {
+			r.vary[n] = header(n)
+		}
+	}
+	return r
+}
+
+// forRequest отдаёт ответ лидера, если он подходит запросу ожидающего.
+func (r *fillResult) forRequest(header func(string) string) (*cachedHTTPResponse, bool) {
+	if r == nil {
+		return nil, false
+	}
+	for n, v := range r.vary {
+		if n == "*" || header == nil || header(n) != v {
+			return nil, false
+		}
+	}
+	return r.entry, true
+}
+
+// shareableResponse — некэшируемый ответ лидера можно отдать ожидающим: он не личный для клиента
+// лидера (Set-Cookie, Cache-Control: private/no-store) и не зависит от всего запроса (Vary: *).
+func shareableResponse(resp *http.Response) bool {
+	if len(resp.Header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	cc := parseCacheControl(resp.Header.Values("Cache-Control"))
+	if cc.has("private") || cc.has("no-store") {
+		return false
+	}
+	return !slices.Contains(varyNames(resp.Header), "*")
+}
+
+// coalesceFill склеивает одинаковые запросы при промахе кэша.
+// leader=true — вызывающий идёт в upstream и обязан вызвать release после записи в кэш
+// (или когда стало ясно, что записи не будет), передав свой ответ или nil, если делиться нечем.
+// leader=false — ожидание закончено: shared — ответ лидера этого процесса; если его нет
+// (кэш заполнял другой экземпляр, лидер не получил ответа или истёк CoalesceTimeout),
+// нужно перечитать кэш и при промахе идти в upstream самому.
+func coalesceFill(ctx context.Context, key string) (leader bool, shared *fillResult, release func(*fillResult)) {
+	noop := func(*fillResult) {}
+	if CoalesceTimeout <= 0 {
+		return true, nil, noop
+	}
+
+	f := &fillFlight{done: make(chan struct{})}
+	if v, loaded := fills.LoadOrStore(key, f); loaded {
+		return false, waitFill(ctx, v.(*fillFlight)), noop
+	}
+	var once sync.Once
+	local := func(res *fillResult) {
+		once.Do(func() {
+			f.result = res
+			fills.CompareAndDelete(key, f)
+			close(f.done)
+		})
+	}
+
+	locker, ok := CacheInstance.(cacheLocker)
+	if !ok {
+		return true, nil, local
+	}
+	lockKey := "lock:" + key
+	unlock, got, err := locker.TryLock(ctx, lockKey, CoalesceTimeout)
+	if err != nil {
+		// кэш-драйвер недоступен — работаем как без блокировки
+		return true, nil, local
+	}
+	if got {
+		return true, nil, func(res *fillResult) {
+			unlock()
+			local(res)
+		}
+	}
+
+	// ключ заполняет другой экземпляр шлюза
+	waitRemoteFill(ctx, locker, lockKey)
+	local(nil)
+	return false, nil, noop
+}
+
+func waitFill(ctx context.Context, f *fillFlight) *fillResult {
+	t := time.NewTimer(CoalesceTimeout)
+	defer t.Stop()
+	select {
+	case <-f.done:
+		return f.result
+	case <-ctx.Done():
+	case <-t.C:
+	}
+	return nil
+}
+
+// waitRemoteFill polls the shared lock until it is released, expires or CoalesceTimeout passes.
+func waitRemoteFill(ctx context.Context, locker cacheLocker, lockKey string) {
+	deadline := time.NewTimer(CoalesceTimeout)
+	defer deadline.Stop()
+	tick := time.NewTicker(25 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline.C:
+			return
+		case <-tick.C:
+			if held, err := locker.Locked(ctx, lockKey); err != nil || !held {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+// lockingMemoryCache emulates a shared cache driver with cluster-wide locks (like Redis).
+type lockingMemoryCache struct {
+	*memoryCacheAdapter
+	mu    sync.Mutex
+	locks map[string]bool
+}
+
+func (m *lockingMemoryCache) TryLock(_ context.Context, key string, _ time.Duration) (func(), bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locks[key] {
+		return nil, false, nil
+	}
+	m.locks[key] = true
+	return func() {
+		m.mu.Lock()
+		delete(m.locks, key)
+		m.mu.Unlock()
+	}, true, nil
+}
+
+func (m *lockingMemoryCache) Locked(_ context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.locks[key], nil
+}
+
+func TestCoalescing_ConcurrentMissesHitBackendOnce(t *testing.T) {
+	t.Cleanup(func() {
+		CacheInstance = nil
+		DefaultCacheTTL = 0
+	})
+
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"v":1}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	services := indexServices([]config.Service{{Name: "svc", ProxyURL: srv.URL}})
+	proxyEp := config.Endpoint{Path: "/proxy", Backend: &config.Backend{Service: "svc", Path: "/"}}
+	aggEp := config.Endpoint{Path: "/agg", Calls: []config.AggCall{{Name: "a", Service: "svc", Path: "/"}}}
+
+	run := func(t *testing.T, path string, apps ...*fiber.App) {
+		t.Helper()
+		atomic.StoreInt32(&hits, 0)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(app *fiber.App) {
+				defer wg.Done()
+				resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil), 2000)
+				if err != nil {
+					t.Errorf("request: %v", err)
+					return
+				}
+				if b, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || len(b) == 0 {
+					t.Errorf("status=%d body=%q", resp.StatusCode, b)
+				}
+			}(apps[i%len(apps)])
+		}
+		wg.Wait()
+		if n := atomic.LoadInt32(&hits); n != 1 {
+			t.Fatalf("%s: backend hits=%d want 1", path, n)
+		}
+	}
+
+	newApp := func() *fiber.App {
+		app := fiber.New()
+		app.Get("/proxy", makeEndpointHandler(services, proxyEp))
+		app.Get("/agg", makeEndpointHandler(services, aggEp))
+		return app
+	}
+	DefaultCacheTTL = time.Minute
+
+	t.Run("local", func(t *testing.T) {
+		CacheInstance = newMemoryCacheAdapter()
+		app := newApp()
+		run(t, "/proxy", app)
+		run(t, "/agg", app)
+	})
+
+	t.Run("cluster", func(t *testing.T) {
+		// ключ заполняет другой экземпляр шлюза: ждём снятия общей блокировки, затем читаем кэш
+		shared := &lockingMemoryCache{memoryCacheAdapter: newMemoryCacheAdapter(), locks: map[string]bool{}}
+		CacheInstance = shared
+		unlock, ok, _ := shared.TryLock(context.Background(), "lock:GET:/proxy", time.Second)
+		if !ok {
+			t.Fatalf("lock not taken")
+		}
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			_ = shared.Set(context.Background(), "GET:/proxy", []byte(`{"status":200,"body":"e30="}`), time.Minute)
+			unlock()
+		}()
+
+		atomic.StoreInt32(&hits, 0)
+		resp, err := newApp().Test(httptest.NewRequest(http.MethodGet, "/proxy", nil), 2000)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		if b, _ := io.ReadAll(resp.Body); string(b) != "{}" || atomic.LoadInt32(&hits) != 0 {
+			t.Fatalf("body=%q hits=%d, want value filled by the other instance", b, hits)
+		}
+	})
+}
+
+func TestCoalescing_SharesUncacheableResponse(t *testing.T) {
+	CacheInstance = newMemoryCacheAdapter()
+	DefaultCacheTTL = time.Minute
+	t.Cleanup(func() {
+		CacheInstance = nil
+		DefaultCacheTTL = 0
+	})
+
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		time.Sleep(100 * time.Millisecond)
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private, max-age=60")
+			fmt.Fprintf(w, "user-%d", n)
+			return
+		}
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not found"}`))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("boom"))
+	}))
+	t.Cleanup(srv.Close)
+
+	services := indexServices([]config.Service{{Name: "svc", ProxyURL: srv.URL}})
+	app := fiber.New()
+	app.Get("/proxy", makeEndpointHandler(services, config.Endpoint{Path: "/proxy", Backend: &config.Backend{Service: "svc", Path: "/"}}))
+	app.Get("/private", makeEndpointHandler(services, config.Endpoint{Path: "/private", CacheMode: "http", Backend: &config.Backend{Service: "svc", Path: "/private"}}))
+	// кэш агрегата выключен — склеиваются только вызовы
+	aggEp := config.Endpoint{Path: "/agg-calls", CacheTTL: "0s", Calls: []config.AggCall{{Name: "a", Service: "svc", Path: "/missing", CacheTTL: "1m"}}}
+	app.Get("/agg-calls", makeEndpointHandler(services, aggEp))
+
+	run := func(path string, wantHits int32, header http.Header, check func(status int, body string)) {
+		t.Helper()
+		atomic.StoreInt32(&hits, 0)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.Header = header.Clone()
+				resp, err := app.Test(req, 2000)
+				if err != nil {
+					t.Errorf("request: %v", err)
+					return
+				}
+				b, _ := io.ReadAll(resp.Body)
+				check(resp.StatusCode, string(b))
+			}()
+		}
+		wg.Wait()
+		if n := atomic.LoadInt32(&hits); n != wantHits {
+			t.Fatalf("%s: backend hits=%d want %d", path, n, wantHits)
+		}
+	}
+
+	run("/proxy", 1, nil, func(status int, body string) {
+		if status != http.StatusInternalServerError || body != "boom" {
+			t.Errorf("status=%d body=%q, want the leader's 500", status, body)
+		}
+	})
+	if _, ok, _ := CacheInstance.Get(context.Background(), "GET:/proxy"); ok {
+		t.Fatal("5xx response was cached")
+	}
+	// 404 вызова не кэшируется, но одновременные такие же вызовы получают его без похода в upstream
+	run("/agg-calls", 1, nil, func(status int, body string) {
+		if status != http.StatusBadGateway {
+			t.Errorf("status=%d body=%q, want aggregate error", status, body)
+		}
+	})
+
+	// Cache-Control: private принадлежит клиенту лидера — каждый ожидающий идёт в upstream сам
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	run("/private", 10, nil, func(status int, body string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if status != http.StatusOK || seen[body] {
+			t.Errorf("status=%d body=%q, want a response of its own", status, body)
+		}
+		seen[body] = true
+	})
+	// запросы с Cookie не склеиваются, даже если ответ общий
+	run("/proxy", 10, http.Header{"Cookie": {"session=a"}}, func(status int, body string) {
+		if status != http.StatusInternalServerError {
+			t.Errorf("status=%d body=%q", status, body)
+		}
+	})
+}
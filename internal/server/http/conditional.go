@@ -0,0 +1,106 @@
+package httpserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Канонические имена валидаторов, под которыми они лежат в cachedHTTPResponse.Headers.
+var (
+	headerETag         = http.CanonicalHeaderKey(fiber.HeaderETag)
+	headerLastModified = http.CanonicalHeaderKey(fiber.HeaderLastModified)
+)
+
+// notModified evaluates If-None-Match / If-Modified-Since of the request against
+// the response validators (RFC 9110 §13.1.2, §13.1.3; If-None-Match takes precedence).
+func notModified(c *fiber.Ctx, headers map[string]string) bool {
+	if inm := c.Get(fiber.HeaderIfNoneMatch); inm != "" {
+		etag := headers[headerETag]
+		if etag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || weakETagEqual(tag, etag) {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := c.Get(fiber.HeaderIfModifiedSince); ims != "" {
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		modified, err := http.ParseTime(headers[headerLastModified])
+		if err != nil {
+			return false
+		}
+		return !modified.After(since)
+	}
+	return false
+}
+
+// weakETagEqual — слабое сравнение: W/"x" и "x" совпадают.
+func weakETagEqual(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// strongETag is a content hash of the serialized body (used for aggregate responses).
+func strongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func hasValidators(r *cachedHTTPResponse) bool {
+	return r != nil && (r.Headers[headerETag] != "" || r.Headers[headerLastModified] != "")
+}
+
+// clearConditionals drops the client's own If-None-Match/If-Modified-Since: a 304 from upstream
+// would answer the client's validators, not the cache entry's, and could be neither cached nor shared.
+func clearConditionals(h http.Header) {
+	h.Del(fiber.HeaderIfNoneMatch)
+	h.Del(fiber.HeaderIfModifiedSince)
+}
+
+// setValidators turns a cached entry into a conditional upstream request.
+func setValidators(h http.Header, r *cachedHTTPResponse) {
+	if etag := r.Headers[headerETag]; etag != "" {
+		h.Set(fiber.HeaderIfNoneMatch, etag)
+	}
+	if lm := r.Headers[headerLastModified]; lm != "" {
+		h.Set(fiber.HeaderIfModifiedSince, lm)
+	}
+}
+
+// validatorRetention — сколько запись с валидаторами живёт в драйвере после всех окон,
+// чтобы истёкший ответ можно было подтвердить 304 вместо полной перезагрузки.
+func validatorRetention(r *cachedHTTPResponse) time.Duration {
+	if !hasValidators(r) {
+		return 0
+	}
+	return max(r.FreshFor, time.Minute)
+}
+
+// refreshed применяет 304 от upstream к старой записи: обновляет заголовки и свежесть, тело остаётся.
+// ok=false — по новым заголовкам ответ кэшировать нельзя (тело всё равно можно отдать один раз).
+func (s proxyCacheStore) refreshed(old *cachedHTTPResponse, resp *http.Response) (*cachedHTTPResponse, []string, bool) {
+	merged := make(http.Header)
+	for k, v := range old.Headers {
+		merged.Set(k, v)
+	}
+	for k, vals := range resp.Header {
+		merged[k] = vals
+	}
+	entry, vary, ok := s.entryFor(&http.Response{StatusCode: old.Status, Header: merged})
+	if !ok {
+		return nil, nil, false
+	}
+	entry.Body = old.Body
+	return entry, vary, true
+}
@@ -0,0 +1,116 @@
+package httpserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+func TestCache_ConditionalRequests(t *testing.T) {
+	t.Cleanup(func() {
+		CacheInstance = nil
+		DefaultCacheTTL = 0
+	})
+	CacheInstance = newMemoryCacheAdapter()
+
+	lastModified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	var full, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Write([]byte(`{"title":"hello"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	services := indexServices([]config.Service{{Name: "svc", ProxyURL: srv.URL}})
+	app := fiber.New()
+	app.Get("/doc", makeEndpointHandler(services, config.Endpoint{
+		Path: "/doc", CacheTTL: "50ms",
+		Backend: &config.Backend{Service: "svc", Path: "/"},
+	}))
+	app.Get("/cold", makeEndpointHandler(services, config.Endpoint{
+		Path: "/cold", CacheTTL: "1m",
+		Backend: &config.Backend{Service: "svc", Path: "/"},
+	}))
+	app.Get("/agg", makeEndpointHandler(services, config.Endpoint{
+		Path:  "/agg",
+		Calls: []config.AggCall{{Name: "doc", Service: "svc", Path: "/"}},
+	}))
+
+	get := func(path string, headers ...string) (string, *http.Response) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := app.Test(req, 2000)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return string(b), resp
+	}
+
+	if _, resp := get("/doc"); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != `"v1"` {
+		t.Fatalf("first: status=%d etag=%q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+
+	// совпавшие валидаторы клиента на попадании в кэш — 304 без тела
+	if body, resp := get("/doc", "If-None-Match", `W/"v0", "v1"`); resp.StatusCode != http.StatusNotModified || body != "" {
+		t.Fatalf("If-None-Match: status=%d body=%q", resp.StatusCode, body)
+	}
+	if _, resp := get("/doc", "If-Modified-Since", time.Now().UTC().Format(http.TimeFormat)); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("If-Modified-Since: status=%d", resp.StatusCode)
+	}
+	if _, resp := get("/doc", "If-None-Match", `"other"`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("mismatched etag: status=%d", resp.StatusCode)
+	}
+
+	// истёкшая запись подтверждается условным запросом к backend, тело не перекачивается
+	time.Sleep(80 * time.Millisecond)
+	body, resp := get("/doc")
+	if body != `{"title":"hello"}` || resp.Header.Get(XCacheHeader) != "REVALIDATED" {
+		t.Fatalf("revalidation: body=%q X-Cache=%q", body, resp.Header.Get(XCacheHeader))
+	}
+	if full.Load() != 1 || notModified.Load() != 1 {
+		t.Fatalf("backend full=%d 304=%d, want 1 and 1", full.Load(), notModified.Load())
+	}
+	if _, resp := get("/doc"); resp.Header.Get(XCacheHeader) != "HIT" {
+		t.Fatalf("after revalidation X-Cache=%q", resp.Header.Get(XCacheHeader))
+	}
+
+	// валидаторы клиента не уходят в upstream: промах кэшируется полным ответом,
+	// а 304 клиенту отдаёт сам шлюз
+	if body, resp := get("/cold", "If-None-Match", `"v1"`); resp.StatusCode != http.StatusNotModified || body != "" {
+		t.Fatalf("cold If-None-Match: status=%d body=%q", resp.StatusCode, body)
+	}
+	if full.Load() != 2 || notModified.Load() != 1 {
+		t.Fatalf("client validators forwarded: backend full=%d 304=%d", full.Load(), notModified.Load())
+	}
+	if body, resp := get("/cold"); body != `{"title":"hello"}` || resp.Header.Get(XCacheHeader) != "HIT" {
+		t.Fatalf("cold after miss: body=%q X-Cache=%q", body, resp.Header.Get(XCacheHeader))
+	}
+
+	// агрегат получает сильный ETag от тела
+	_, resp = get("/agg")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || len(etag) < 3 || etag[0] != '"' {
+		t.Fatalf("aggregate etag=%q", etag)
+	}
+	if _, resp := get("/agg", "If-None-Match", etag); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("aggregate If-None-Match: status=%d", resp.StatusCode)
+	}
+}
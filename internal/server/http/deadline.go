@@ -0,0 +1,88 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+// DeadlineHeader, if set, is sent to upstreams with the remaining request budget
+// in grpc-timeout format (e.g. "1500m" = 1.5s). An incoming header with the same name
+// also bounds the request, so chained gateways share one budget.
+var DeadlineHeader string
+
+// requestContext returns the upstream context of a request: derived from the incoming
+// request (cancelled when the client disconnects or the gateway shutdown timeout
+// expires) and bounded by the endpoint's overall timeout.
+func requestContext(c *fiber.Ctx, ep config.Endpoint) (context.Context, context.CancelFunc) {
+	ctx := c.UserContext()
+
+	budget := parseTTL(ep.Timeout)
+	if DeadlineHeader != "" {
+		if d, ok := parseGRPCTimeout(c.Get(DeadlineHeader)); ok && (budget <= 0 || d < budget) {
+			budget = d
+		}
+	}
+	if budget > 0 {
+		return context.WithTimeout(ctx, budget)
+	}
+	return context.WithCancel(ctx)
+}
+
+// setDeadlineHeader tells the upstream how much time is left before the gateway gives up.
+func setDeadlineHeader(ctx context.Context, h http.Header) {
+	if DeadlineHeader == "" {
+		return
+	}
+	dl, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	left := time.Until(dl)
+	if left <= 0 {
+		return
+	}
+	h.Set(DeadlineHeader, formatGRPCTimeout(left))
+}
+
+func formatGRPCTimeout(d time.Duration) string {
+	ms := d.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return strconv.FormatInt(ms, 10) + "m"
+}
+
+// parseGRPCTimeout parses "<digits><unit>" with units H, M, S, m, u, n.
+func parseGRPCTimeout(v string) (time.Duration, bool) {
+	if len(v) < 2 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	var unit time.Duration
+	switch v[len(v)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
@@ -0,0 +1,227 @@
+package httpserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+func TestParseGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"1500m", 1500 * time.Millisecond, true},
+		{"2S", 2 * time.Second, true},
+		{"1H", time.Hour, true},
+		{"10x", 0, false},
+		{"m", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseGRPCTimeout(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Fatalf("parseGRPCTimeout(%q) = %v,%v want %v,%v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDeadline_PropagatedAndBoundsAggregate(t *testing.T) {
+	DeadlineHeader = "X-Request-Deadline"
+	t.Cleanup(func() { DeadlineHeader = "" })
+
+	var seen atomic.Value
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen.Store(r.Header.Get("X-Request-Deadline"))
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	slowDone := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(slowDone)
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	t.Cleanup(func() {
+		fast.Close()
+		slow.Close()
+	})
+
+	services := map[string]config.Service{
+		"fast": {Name: "fast", ProxyURL: fast.URL, Timeout: "5s"},
+		"slow": {Name: "slow", ProxyURL: slow.URL, Timeout: "5s"},
+	}
+
+	app := fiber.New()
+	app.Get("/proxy", makeEndpointHandler(services, config.Endpoint{Timeout: "3s", Backend: &config.Backend{Service: "fast", Path: "/"}}))
+	app.Get("/agg", makeEndpointHandler(services, config.Endpoint{
+		Path:    "/agg",
+		Timeout: "100ms",
+		Calls: []config.AggCall{
+			{Name: "fast", Service: "fast", Path: "/"},
+			{Name: "slow", Service: "slow", Path: "/"},
+		},
+	}))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/proxy", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("proxy err=%v status=%v", err, resp.StatusCode)
+	}
+	budget, ok := parseGRPCTimeout(seen.Load().(string))
+	if !ok || budget <= 0 || budget > 3*time.Second {
+		t.Fatalf("upstream deadline header=%q", seen.Load())
+	}
+
+	// a tighter incoming budget wins over the endpoint timeout
+	req := httptest.NewRequest(http.MethodGet, "/proxy", nil)
+	req.Header.Set("X-Request-Deadline", "500m")
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("proxy err=%v", err)
+	}
+	if budget, _ := parseGRPCTimeout(seen.Load().(string)); budget > 500*time.Millisecond {
+		t.Fatalf("incoming deadline not honoured: %v", budget)
+	}
+
+	start := time.Now()
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/agg", nil), -1)
+	if err != nil || resp.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("aggregate err=%v status=%v, want 504", err, resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("aggregate took %v despite 100ms deadline", elapsed)
+	}
+	select {
+	case <-slowDone:
+	case <-time.After(time.Second):
+		t.Fatalf("slow upstream request was not cancelled")
+	}
+}
+
+func TestRequestContext_CancelledOnClientDisconnect(t *testing.T) {
+	cancelled := make(chan struct{})
+	started := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	services := map[string]config.Service{"svc": {Name: "svc", ProxyURL: upstream.URL, Timeout: "10s"}}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(requestContextMiddleware(context.Background()))
+	app.Get("/slow", makeEndpointHandler(services, config.Endpoint{Backend: &config.Backend{Service: "svc", Path: "/"}}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("request never reached upstream")
+	}
+	_ = conn.Close()
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("upstream context was not cancelled after client disconnect")
+	}
+}
+
+func TestServer_ShutdownLetsInFlightRequestsFinish(t *testing.T) {
+	started := make(chan struct{}, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-time.After(300 * time.Millisecond):
+			w.Write([]byte("done"))
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	addr := freeAddr(t)
+	cfg := &config.FinalConfig{
+		Gateway:   config.Gateway{Address: addr, ShutdownTimeoutSec: 5},
+		Services:  []config.Service{{Name: "svc", ProxyURL: upstream.URL, Timeout: "5s"}},
+		Endpoints: []config.Endpoint{{Path: "/slow", Method: http.MethodGet, Backend: &config.Backend{Service: "svc", Path: "/"}}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- New(cfg).Start(ctx) }()
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		var resp *http.Response
+		var err error
+		for i := 0; i < 50; i++ {
+			if resp, err = http.Get("http://" + addr + "/slow"); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			resCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		resCh <- result{status: resp.StatusCode, body: string(b), err: err}
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("request never reached upstream")
+	}
+	cancel()
+
+	select {
+	case res := <-resCh:
+		if res.err != nil || res.status != http.StatusOK || res.body != "done" {
+			t.Fatalf("in-flight request during shutdown: status=%d body=%q err=%v", res.status, res.body, res.err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("in-flight request did not complete")
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("server did not stop")
+	}
+}
@@ -0,0 +1,97 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// disconnectPollInterval — как часто проверяется, не закрыл ли клиент соединение, пока идёт handler.
+// fasthttp не читает сокет во время обработки запроса и сам об отключении не сообщает.
+var disconnectPollInterval = 100 * time.Millisecond
+
+const releaseLocal = "waiterd.release"
+
+// requestContextMiddleware даёт каждому запросу свой контекст: он отменяется, когда клиент
+// закрыл соединение или истекло время на graceful shutdown (отмена base). От него наследуются
+// контексты вызовов upstream (requestContext), поэтому отключение клиента отменяет и их.
+func requestContextMiddleware(base context.Context) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithCancel(base)
+		stop := watchDisconnect(c.Context().Conn(), cancel)
+		release := sync.OnceFunc(func() {
+			stop()
+			cancel()
+		})
+		c.SetUserContext(ctx)
+		c.Locals(releaseLocal, release)
+
+		err := c.Next()
+		if r, ok := c.Locals(releaseLocal).(func()); ok {
+			r()
+		}
+		return err
+	}
+}
+
+// takeRequestRelease забирает у middleware освобождение контекста запроса: ответ, который
+// пишется потоком уже после выхода из handler, вызывает его сам, когда поток закрыт.
+func takeRequestRelease(c *fiber.Ctx) func() {
+	r, ok := c.Locals(releaseLocal).(func())
+	if !ok {
+		return func() {}
+	}
+	c.Locals(releaseLocal, nil)
+	return r
+}
+
+// watchDisconnect вызывает onClose, когда клиент закрыл или сбросил соединение.
+// Для соединений без сокета (тесты, прогрев) и на платформах без peekClosed ничего не делает.
+func watchDisconnect(conn net.Conn, onClose func()) (stop func()) {
+	if sc, ok := conn.(interface{ Context() context.Context }); ok {
+		// запрос HTTP/2 (h2Conn): контекст потока отменяет net/http
+		after := context.AfterFunc(sc.Context(), onClose)
+		return func() { after() }
+	}
+	rc := rawConn(conn)
+	if rc == nil || !canPeekClosed {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(disconnectPollInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if peekClosed(rc) {
+					onClose()
+					return
+				}
+			}
+		}
+	}()
+	return sync.OnceFunc(func() { close(done) })
+}
+
+func rawConn(conn net.Conn) syscall.RawConn {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	return rc
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package httpserver
+
+import "syscall"
+
+// Без неблокирующего MSG_PEEK отключение клиента во время handler не отслеживается;
+// потоковые ответы по-прежнему отменяются при ошибке записи.
+const canPeekClosed = false
+
+func peekClosed(syscall.RawConn) bool { return false }
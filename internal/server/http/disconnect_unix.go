@@ -0,0 +1,28 @@
+//go:build linux || darwin
+
+package httpserver
+
+import (
+	"errors"
+	"syscall"
+)
+
+const canPeekClosed = true
+
+// peekClosed смотрит в сокет, ничего из него не забирая (MSG_PEEK): 0 байт — клиент прислал FIN,
+// ECONNRESET — RST. Непрочитанные данные (тело запроса, pipelining) закрытием не считаются.
+func peekClosed(rc syscall.RawConn) bool {
+	closed := false
+	_ = rc.Read(func(fd uintptr) bool {
+		var b [1]byte
+		n, _, err := syscall.Recvfrom(int(fd), b[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		switch {
+		case err == nil:
+			closed = n == 0
+		case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+			closed = true
+		}
+		return true
+	})
+	return closed
+}
@@ -18,6 +18,7 @@ func forwardHeadersFromFiber(c *fiber.Ctx) http.Header {
 		"User-Agent",
 		"X-Forwarded-For",
 		"X-Real-IP",
+		ClientCertSubjectHeader,
 	} {
 		if v := c.Get(k); v != "" {
 			h.Set(k, v)
@@ -0,0 +1,521 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"waiterd/internal/config"
+)
+
+// grpcUpstreams caches one client connection + descriptors per gRPC service.
+var grpcUpstreams sync.Map // service name -> *grpcUpstream
+
+// grpcUpstream держит соединение и дескрипторы одного gRPC-сервиса.
+type grpcUpstream struct {
+	svc  config.Service
+	conn *grpc.ClientConn
+
+	// descs читается без блокировок; mu нужен только чтобы опубликовать результат reflection,
+	// а сам запрос reflection выполняется один на символ (reflecting) и вне mu.
+	descs      atomic.Pointer[grpcDescriptors]
+	mu         sync.Mutex
+	reflecting singleflight.Group
+}
+
+// grpcDescriptors — неизменяемый снимок известных дескрипторов сервиса.
+type grpcDescriptors struct {
+	fdps  []*descriptorpb.FileDescriptorProto
+	files *protoregistry.Files
+}
+
+// grpcForwardHeaders — какие заголовки входящего запроса уходят в gRPC metadata.
+var grpcForwardHeaders = []string{"Authorization", "X-Request-Id", "X-Forwarded-For", "X-Real-IP", ClientCertSubjectHeader}
+
+func grpcUpstreamFor(svc config.Service) (*grpcUpstream, error) {
+	if v, ok := grpcUpstreams.Load(svc.Name); ok {
+		return v.(*grpcUpstream), nil
+	}
+
+	base, err := parseBaseURL(svc.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy_url %q: %w", svc.ProxyURL, err)
+	}
+	creds := insecure.NewCredentials()
+	if svc.Client != nil && svc.Client.TLS != nil {
+		tlsCfg, err := clientTLSConfig(svc.Client.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("grpc client %q: %w", svc.Name, err)
+		}
+		creds = credentials.NewTLS(tlsCfg)
+	} else if base.Scheme == "https" {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	target := base.Host
+	if socket, _, ok := unixSocketPath(svc.ProxyURL); ok {
+		target = "unix://" + socket
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("grpc client %q: %w", svc.Name, err)
+	}
+
+	up := &grpcUpstream{svc: svc, conn: conn}
+	if svc.DescriptorSet != "" {
+		if err := up.loadDescriptorSet(svc.DescriptorSet); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	if v, loaded := grpcUpstreams.LoadOrStore(svc.Name, up); loaded {
+		_ = conn.Close()
+		return v.(*grpcUpstream), nil
+	}
+	return up, nil
+}
+
+// closeGRPCUpstreams закрывает соединения всех gRPC-сервисов — вызывается при остановке шлюза,
+// когда запросы уже завершены. Следующий grpcUpstreamFor откроет соединение заново.
+func closeGRPCUpstreams() {
+	grpcUpstreams.Range(func(k, v any) bool {
+		grpcUpstreams.Delete(k)
+		if err := v.(*grpcUpstream).conn.Close(); err != nil {
+			log.Printf("[waiterd] grpc close svc=%v: %v", k, err)
+		}
+		return true
+	})
+}
+
+func (g *grpcUpstream) loadDescriptorSet(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read descriptor_set %q: %w", path, err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("parse descriptor_set %q: %w", path, err)
+	}
+	files, err := buildProtoFiles(set.File)
+	if err != nil {
+		return fmt.Errorf("descriptor_set %q: %w", path, err)
+	}
+	g.descs.Store(&grpcDescriptors{fdps: set.File, files: files})
+	return nil
+}
+
+// findMethod resolves "/pkg.Service/Method" to its descriptor, asking server reflection
+// for services that are not known yet (when reflection is enabled).
+func (g *grpcUpstream) findMethod(ctx context.Context, fullMethod string) (protoreflect.MethodDescriptor, error) {
+	svcName, methodName, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok || svcName == "" || methodName == "" {
+		return nil, fmt.Errorf("grpc method must look like /package.Service/Method, got %q", fullMethod)
+	}
+
+	sd, err := g.findService(svcName)
+	if err != nil && g.svc.Reflection {
+		// одновременные запросы к неизвестному сервису ждут один запрос reflection; он не
+		// отменяется вместе с запросом, который его начал, — результат нужен и остальным
+		_, rerr, _ := g.reflecting.Do(svcName, func() (any, error) {
+			if _, err := g.findService(svcName); err == nil {
+				return nil, nil // опубликовал reflection, который закончился только что
+			}
+			rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), serviceTimeout(g.svc))
+			defer cancel()
+			return nil, g.reflect(rctx, svcName)
+		})
+		if rerr != nil {
+			return nil, rerr
+		}
+		sd, err = g.findService(svcName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	md := sd.Methods().ByName(protoreflect.Name(methodName))
+	if md == nil {
+		return nil, fmt.Errorf("grpc method %q not found in %s", methodName, svcName)
+	}
+	return md, nil
+}
+
+func (g *grpcUpstream) findService(name string) (protoreflect.ServiceDescriptor, error) {
+	descs := g.descs.Load()
+	if descs == nil {
+		return nil, fmt.Errorf("no descriptors for service %q (set descriptor_set or reflection)", g.svc.Name)
+	}
+	d, err := descs.files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("grpc service %q: %w", name, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a grpc service", name)
+	}
+	return sd, nil
+}
+
+// reflect загружает через server reflection файл с символом и все его зависимости.
+func (g *grpcUpstream) reflect(ctx context.Context, symbol string) error {
+	stream, err := reflectionpb.NewServerReflectionClient(g.conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("grpc reflection: %w", err)
+	}
+	defer func() { _ = stream.CloseSend() }()
+
+	var current []*descriptorpb.FileDescriptorProto
+	if descs := g.descs.Load(); descs != nil {
+		current = descs.fdps
+	}
+	known := make(map[string]bool, len(current))
+	for _, f := range current {
+		known[f.GetName()] = true
+	}
+	fdps := append([]*descriptorpb.FileDescriptorProto{}, current...)
+
+	ask := func(req *reflectionpb.ServerReflectionRequest) error {
+		if err := stream.Send(req); err != nil {
+			return err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return fmt.Errorf("%s", e.GetErrorMessage())
+		}
+		for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			var fdp descriptorpb.FileDescriptorProto
+			if err := proto.Unmarshal(raw, &fdp); err != nil {
+				return err
+			}
+			if !known[fdp.GetName()] {
+				known[fdp.GetName()] = true
+				fdps = append(fdps, &fdp)
+			}
+		}
+		return nil
+	}
+
+	if err := ask(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	}); err != nil {
+		return fmt.Errorf("grpc reflection %q: %w", symbol, err)
+	}
+	// сервер обычно отдаёт зависимости сразу, но догружаем недостающие по имени файла
+	for i := 0; i < len(fdps); i++ {
+		for _, dep := range fdps[i].GetDependency() {
+			if known[dep] {
+				continue
+			}
+			if _, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+				continue
+			}
+			if err := ask(&reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+			}); err != nil {
+				return fmt.Errorf("grpc reflection %q: %w", dep, err)
+			}
+		}
+	}
+
+	return g.publish(fdps[len(current):])
+}
+
+// publish добавляет загруженные файлы к текущему снимку. Снимок мог смениться, пока шёл
+// reflection другого сервиса, поэтому слияние идёт с тем, что опубликовано сейчас.
+func (g *grpcUpstream) publish(loaded []*descriptorpb.FileDescriptorProto) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var fdps []*descriptorpb.FileDescriptorProto
+	if descs := g.descs.Load(); descs != nil {
+		fdps = append(fdps, descs.fdps...)
+	}
+	known := make(map[string]bool, len(fdps))
+	for _, f := range fdps {
+		known[f.GetName()] = true
+	}
+	for _, f := range loaded {
+		if !known[f.GetName()] {
+			known[f.GetName()] = true
+			fdps = append(fdps, f)
+		}
+	}
+	files, err := buildProtoFiles(fdps)
+	if err != nil {
+		return err
+	}
+	g.descs.Store(&grpcDescriptors{fdps: fdps, files: files})
+	return nil
+}
+
+// buildProtoFiles registers file descriptors in dependency order; well-known imports
+// missing from the set are taken from the compiled-in registry.
+func buildProtoFiles(fdps []*descriptorpb.FileDescriptorProto) (*protoregistry.Files, error) {
+	byName := make(map[string]*descriptorpb.FileDescriptorProto, len(fdps))
+	for _, f := range fdps {
+		byName[f.GetName()] = f
+	}
+
+	files := new(protoregistry.Files)
+	var register func(name string) error
+	register = func(name string) error {
+		if _, err := files.FindFileByPath(name); err == nil {
+			return nil
+		}
+		fdp, ok := byName[name]
+		if !ok {
+			fd, err := protoregistry.GlobalFiles.FindFileByPath(name)
+			if err != nil {
+				return fmt.Errorf("missing proto dependency %q", name)
+			}
+			return files.RegisterFile(fd)
+		}
+		for _, dep := range fdp.GetDependency() {
+			if err := register(dep); err != nil {
+				return err
+			}
+		}
+		fd, err := protodesc.NewFile(fdp, files)
+		if err != nil {
+			return fmt.Errorf("proto file %q: %w", name, err)
+		}
+		return files.RegisterFile(fd)
+	}
+
+	for _, f := range fdps {
+		if err := register(f.GetName()); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// callGRPC транскодирует HTTP/JSON в unary gRPC вызов: тело (JSON), path-параметры и query
+// заполняют сообщение запроса, ответ возвращается как JSON со статусом, сопоставленным коду gRPC.
+func callGRPC(ctx context.Context, svc config.Service, fullMethod string, body []byte, params map[string]string, query url.Values, headers http.Header) ([]byte, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, serviceTimeout(svc))
+	defer cancel()
+
+	up, err := grpcUpstreamFor(svc)
+	if err != nil {
+		return nil, 0, err
+	}
+	md, err := up.findMethod(ctx, fullMethod)
+	if err != nil {
+		return nil, 0, err
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, 0, fmt.Errorf("grpc method %s is streaming, only unary calls are supported", md.FullName())
+	}
+
+	req := dynamicpb.NewMessage(md.Input())
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, req); err != nil {
+			return grpcErrorJSON(codes.InvalidArgument, "invalid request body: "+err.Error())
+		}
+	}
+	for k, v := range params {
+		if err := setProtoField(req, k, v); err != nil {
+			return grpcErrorJSON(codes.InvalidArgument, err.Error())
+		}
+	}
+	for k, vals := range query {
+		for _, v := range vals {
+			if err := setProtoField(req, k, v); err != nil {
+				return grpcErrorJSON(codes.InvalidArgument, err.Error())
+			}
+		}
+	}
+
+	pairs := make([]string, 0, len(grpcForwardHeaders)*2)
+	for _, k := range grpcForwardHeaders {
+		if v := headers.Get(k); v != "" {
+			pairs = append(pairs, strings.ToLower(k), v)
+		}
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, pairs...)
+
+	resp := dynamicpb.NewMessage(md.Output())
+	method := "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+	if err := up.conn.Invoke(ctx, method, req, resp); err != nil {
+		st := status.Convert(err)
+		return grpcErrorJSON(st.Code(), st.Message())
+	}
+
+	out, err := protojson.Marshal(resp)
+	if err != nil {
+		return nil, 0, fmt.Errorf("marshal grpc response: %w", err)
+	}
+	return out, http.StatusOK, nil
+}
+
+func grpcErrorJSON(code codes.Code, msg string) ([]byte, int, error) {
+	b, _ := json.Marshal(map[string]any{"code": int(code), "status": code.String(), "message": msg})
+	return b, grpcHTTPStatus(code), nil
+}
+
+// grpcHTTPStatus — общепринятое сопоставление кодов gRPC и HTTP (как в grpc-gateway).
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// setProtoField sets a (possibly dotted, e.g. "filter.status") field from a string value.
+// Unknown fields are ignored so extra query params don't break calls.
+func setProtoField(msg protoreflect.Message, path, value string) error {
+	parts := strings.Split(path, ".")
+	for i, name := range parts {
+		fd := protoFieldByName(msg.Descriptor(), name)
+		if fd == nil || fd.IsMap() {
+			return nil
+		}
+		if i < len(parts)-1 {
+			if fd.Kind() != protoreflect.MessageKind || fd.IsList() {
+				return nil
+			}
+			msg = msg.Mutable(fd).Message()
+			continue
+		}
+		if fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+			return nil
+		}
+		v, err := protoScalarFromString(fd, value)
+		if err != nil {
+			return fmt.Errorf("field %q: %w", path, err)
+		}
+		if fd.IsList() {
+			msg.Mutable(fd).List().Append(v)
+		} else {
+			msg.Set(fd, v)
+		}
+	}
+	return nil
+}
+
+func protoFieldByName(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if fd := md.Fields().ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	return md.Fields().ByJSONName(name)
+}
+
+func protoScalarFromString(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BytesKind:
+		if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+			return protoreflect.ValueOfBytes(b), nil
+		}
+		return protoreflect.ValueOfBytes([]byte(s)), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(n)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		n, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), err
+	}
+	return protoreflect.Value{}, errors.New("unsupported field kind " + fd.Kind().String())
+}
+
+// grpcBackendHandler проксирует endpoint в unary gRPC метод, указанный в backend.path как /package.Service/Method.
+func grpcBackendHandler(svc config.Service, ep config.Endpoint) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		logReq := reqLogger(c)
+
+		ctx, cancel := requestContext(c, ep)
+		defer cancel()
+
+		body, err := requestBody(c)
+		if err != nil {
+			return sendBodyError(c, err)
+		}
+		query, _ := url.ParseQuery(rawQueryFromOriginal(c.OriginalURL()))
+		out, status, err := callGRPC(ctx, svc, ep.Backend.Path, body, c.AllParams(), query, forwardHeadersFromFiber(c))
+		if err != nil {
+			logReq("[waiterd] grpc backend svc=%s method=%s error: %v", svc.Name, ep.Backend.Path, err)
+			return c.Status(http.StatusBadGateway).SendString("backend unavailable")
+		}
+		logReq("[waiterd][call] svc=%s grpc=%s status=%d", svc.Name, ep.Backend.Path, status)
+
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Status(status).Send(out)
+	}
+}
@@ -0,0 +1,270 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"waiterd/internal/config"
+)
+
+// echoProto describes test.Echo/Say(EchoRequest{text,id}) returns EchoReply{text,id,auth}.
+func echoProto() *descriptorpb.FileDescriptorProto {
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(num),
+			Type:     typ.Enum(),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+	}
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("echo.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("EchoRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("text", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("id", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+			}},
+			{Name: proto.String("EchoReply"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("text", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("id", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+				field("auth", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Echo"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Say"),
+				InputType:  proto.String(".test.EchoRequest"),
+				OutputType: proto.String(".test.EchoReply"),
+			}},
+		}},
+	}
+}
+
+// startEchoServer runs test.Echo (and server reflection) on a random port.
+func startEchoServer(t *testing.T, opts ...grpc.ServerOption) (addr string, descriptorSet string) {
+	t.Helper()
+
+	fdp := echoProto()
+	files, err := buildProtoFiles([]*descriptorpb.FileDescriptorProto{fdp})
+	if err != nil {
+		t.Fatalf("build files: %v", err)
+	}
+	d, _ := files.FindDescriptorByName("test.Echo")
+	md := d.(protoreflect.ServiceDescriptor).Methods().ByName("Say")
+
+	srv := grpc.NewServer(opts...)
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Echo",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Say",
+			Handler: func(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				in := dynamicpb.NewMessage(md.Input())
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				id := in.Get(md.Input().Fields().ByName("id")).Int()
+				if id == 404 {
+					return nil, status.Error(codes.NotFound, "no such item")
+				}
+				out := dynamicpb.NewMessage(md.Output())
+				out.Set(md.Output().Fields().ByName("text"), in.Get(md.Input().Fields().ByName("text")))
+				out.Set(md.Output().Fields().ByName("id"), protoreflect.ValueOfInt32(int32(id)))
+				if m, ok := metadata.FromIncomingContext(ctx); ok && len(m.Get("authorization")) > 0 {
+					out.Set(md.Output().Fields().ByName("auth"), protoreflect.ValueOfString(m.Get("authorization")[0]))
+				}
+				return out, nil
+			},
+		}},
+	}, struct{}{})
+	reflectionpb.RegisterServerReflectionServer(srv, reflection.NewServerV1(reflection.ServerOptions{
+		Services:           srv,
+		DescriptorResolver: files,
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(srv.Stop)
+
+	raw, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fdp}})
+	descriptorSet = filepath.Join(t.TempDir(), "echo.protoset")
+	if err := os.WriteFile(descriptorSet, raw, 0o644); err != nil {
+		t.Fatalf("write descriptor set: %v", err)
+	}
+	return ln.Addr().String(), descriptorSet
+}
+
+func TestGRPCBackend_Transcoding(t *testing.T) {
+	addr, descriptorSet := startEchoServer(t)
+
+	for _, svc := range []config.Service{
+		{Name: "echo-file", ProxyURL: addr, Transport: "grpc", DescriptorSet: descriptorSet},
+		{Name: "echo-reflect", ProxyURL: addr, Transport: "grpc", Reflection: true},
+	} {
+		t.Run(svc.Name, func(t *testing.T) {
+			t.Cleanup(func() { grpcUpstreams.Delete(svc.Name) })
+
+			cfg := &config.FinalConfig{
+				Services: []config.Service{svc},
+				Endpoints: []config.Endpoint{
+					{Path: "/echo/{id}", Method: http.MethodGet, Backend: &config.Backend{Service: svc.Name, Path: "/test.Echo/Say"}},
+					{Path: "/echo", Method: http.MethodPost, Backend: &config.Backend{Service: svc.Name, Path: "/test.Echo/Say"}},
+				},
+			}
+			app := fiber.New()
+			RegisterRoutes(app, cfg)
+
+			req := httptest.NewRequest(http.MethodGet, "/echo/7?text=hi", nil)
+			req.Header.Set("Authorization", "Bearer t")
+			resp, err := app.Test(req, -1)
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("get err=%v status=%v", err, resp.StatusCode)
+			}
+			var got map[string]any
+			_ = json.NewDecoder(resp.Body).Decode(&got)
+			if got["text"] != "hi" || got["id"] != float64(7) || got["auth"] != "Bearer t" {
+				t.Fatalf("get body=%v", got)
+			}
+
+			resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{"text":"body","id":3}`)), -1)
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("post err=%v status=%v", err, resp.StatusCode)
+			}
+			got = nil
+			_ = json.NewDecoder(resp.Body).Decode(&got)
+			if len(got) != 2 || got["text"] != "body" || got["id"] != float64(3) {
+				t.Fatalf("post body=%v", got)
+			}
+
+			resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/echo/404", nil), -1)
+			if err != nil || resp.StatusCode != http.StatusNotFound {
+				t.Fatalf("not found err=%v status=%v", err, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestAggregate_MixesGRPCAndHTTP(t *testing.T) {
+	addr, descriptorSet := startEchoServer(t)
+	t.Cleanup(func() { grpcUpstreams.Delete("echo") })
+
+	rest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"title":"hello"}`))
+	}))
+	t.Cleanup(rest.Close)
+
+	services := map[string]config.Service{
+		"echo": {Name: "echo", ProxyURL: addr, Transport: "grpc", DescriptorSet: descriptorSet},
+		"rest": {Name: "rest", ProxyURL: rest.URL},
+	}
+	ep := config.Endpoint{
+		Path: "/mix/{id}",
+		Calls: []config.AggCall{
+			{Name: "echo", Service: "echo", Path: "/test.Echo/Say"},
+			{Name: "post", Service: "rest", Path: "/p"},
+		},
+		ResponseMapping: map[string]string{"id": "echo.id", "title": "post.title"},
+	}
+
+	app := fiber.New()
+	app.Get("/mix/:id", makeEndpointHandler(services, ep))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/mix/5", nil), -1)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("err=%v status=%v", err, resp.StatusCode)
+	}
+	var got map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&got)
+	if got["id"] != float64(5) || got["title"] != "hello" {
+		t.Fatalf("body=%v", got)
+	}
+}
+
+func TestGRPCUpstream_ConcurrentReflection(t *testing.T) {
+	var reflections atomic.Int32
+	addr, _ := startEchoServer(t, grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, h grpc.StreamHandler) error {
+		reflections.Add(1)
+		return h(srv, ss)
+	}))
+	svc := config.Service{Name: "echo-concurrent", ProxyURL: addr, Transport: "grpc", Reflection: true}
+	t.Cleanup(func() { grpcUpstreams.Delete(svc.Name) })
+
+	up, err := grpcUpstreamFor(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := up.findMethod(context.Background(), "/test.Echo/Say"); err != nil {
+				t.Errorf("findMethod: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := reflections.Load(); n != 1 {
+		t.Fatalf("reflection streams=%d, want 1", n)
+	}
+	if _, err := up.findMethod(context.Background(), "/test.Echo/Nope"); err == nil {
+		t.Fatal("expected error for unknown method")
+	}
+	if n := reflections.Load(); n != 1 {
+		t.Fatalf("known service reflected again: %d streams", n)
+	}
+}
+
+func TestCloseGRPCUpstreams(t *testing.T) {
+	addr, _ := startEchoServer(t)
+	svc := config.Service{Name: "echo-close", ProxyURL: addr, Transport: "grpc", Reflection: true}
+	t.Cleanup(func() { grpcUpstreams.Delete(svc.Name) })
+
+	up, err := grpcUpstreamFor(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeGRPCUpstreams()
+
+	if st := up.conn.GetState(); st != connectivity.Shutdown {
+		t.Fatalf("conn state=%v, want Shutdown", st)
+	}
+	if _, ok := grpcUpstreams.Load(svc.Name); ok {
+		t.Fatalf("closed upstream still cached")
+	}
+	// после остановки соединение открывается заново
+	again, err := grpcUpstreamFor(svc)
+	if err != nil || again == up {
+		t.Fatalf("reopen: up=%p again=%p err=%v", up, again, err)
+	}
+	_ = again.conn.Close()
+}
@@ -0,0 +1,223 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+
+	"waiterd/internal/config"
+)
+
+// fasthttp не умеет HTTP/2, поэтому TLS-листенер раздаёт соединения по ALPN: h2 обслуживает
+// net/http и передаёт каждый запрос в тот же fasthttp-обработчик fiber, остальное — fasthttp напрямую.
+
+// h2HopHeaders не переносятся из ответа fasthttp в ответ HTTP/2.
+var h2HopHeaders = map[string]bool{
+	"Connection":        true,
+	"Keep-Alive":        true,
+	"Proxy-Connection":  true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// h2SkipRequestHeaders задаются запросу fasthttp отдельно (Host, тело) или не имеют смысла в HTTP/1.1.
+var h2SkipRequestHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Connection":        true,
+	"Transfer-Encoding": true,
+}
+
+type tlsConnKey struct{}
+
+// newH2Server — сервер HTTP/2 поверх соединений, для которых по ALPN согласован h2.
+func newH2Server(handler fasthttp.RequestHandler, gw config.Gateway) *http.Server {
+	return &http.Server{
+		Handler:           h2Handler(handler, gw.BodyLimit),
+		ReadHeaderTimeout: time.Duration(gw.ReadTimeoutSec) * time.Second,
+		IdleTimeout:       time.Duration(gw.IdleTimeoutSec) * time.Second,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, tlsConnKey{}, c)
+		},
+	}
+}
+
+// h2Handler переводит запрос net/http в fasthttp.RequestCtx и пишет ответ обратно.
+// Тела запроса и ответа идут потоком, как и в HTTP/1.1; тело запроса ограничено bodyLimit, как у fiber.
+func h2Handler(handler fasthttp.RequestHandler, bodyLimit int) http.Handler {
+	if bodyLimit <= 0 {
+		bodyLimit = fiber.DefaultBodyLimit
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > int64(bodyLimit) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		tc, _ := r.Context().Value(tlsConnKey{}).(*tls.Conn)
+		if tc == nil {
+			http.Error(w, "http/2 requires tls", http.StatusHTTPVersionNotSupported)
+			return
+		}
+
+		var fctx fasthttp.RequestCtx
+		fctx.Init2(&h2Conn{tls: tc, ctx: r.Context()}, log.Default(), false)
+		req := &fctx.Request
+		req.Header.SetMethod(r.Method)
+		req.SetRequestURI(r.URL.RequestURI())
+		req.Header.SetHost(r.Host)
+		for k, vals := range r.Header {
+			if h2SkipRequestHeaders[k] {
+				continue
+			}
+			for _, v := range vals {
+				req.Header.Add(k, v)
+			}
+		}
+		if r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+			req.SetBodyStream(http.MaxBytesReader(w, r.Body, int64(bodyLimit)), int(r.ContentLength))
+		}
+
+		handler(&fctx)
+
+		resp := &fctx.Response
+		h := w.Header()
+		resp.Header.VisitAll(func(k, v []byte) {
+			if key := string(k); !h2HopHeaders[key] {
+				h.Add(key, string(v))
+			}
+		})
+		w.WriteHeader(resp.StatusCode())
+		if r.Method == http.MethodHead {
+			// закрывает и поток тела, если он был
+			resp.ResetBody()
+			return
+		}
+		if resp.IsBodyStream() {
+			// SSE/chunked: каждый кусок уходит клиенту сразу
+			_ = resp.BodyWriteTo(flushWriter{w})
+			return
+		}
+		_, _ = w.Write(resp.Body())
+	})
+}
+
+type flushWriter struct{ w http.ResponseWriter }
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if fl, ok := f.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+	return n, err
+}
+
+var errH2Conn = errors.New("http/2 stream: the connection belongs to net/http")
+
+// h2Conn — то, что fasthttp-обработчик видит вместо соединения у запроса HTTP/2: адреса,
+// TLS-состояние (mTLS, IsTLS) и контекст потока, который отменяется при RST_STREAM или
+// закрытии соединения. Читать, писать и менять дедлайны нельзя — соединением владеет net/http.
+type h2Conn struct {
+	tls *tls.Conn
+	ctx context.Context
+}
+
+func (c *h2Conn) Read([]byte) (int, error)         { return 0, errH2Conn }
+func (c *h2Conn) Write([]byte) (int, error)        { return 0, errH2Conn }
+func (c *h2Conn) Close() error                     { return nil }
+func (c *h2Conn) LocalAddr() net.Addr              { return c.tls.LocalAddr() }
+func (c *h2Conn) RemoteAddr() net.Addr             { return c.tls.RemoteAddr() }
+func (c *h2Conn) SetDeadline(time.Time) error      { return nil }
+func (c *h2Conn) SetReadDeadline(time.Time) error  { return nil }
+func (c *h2Conn) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *h2Conn) Handshake() error                     { return nil }
+func (c *h2Conn) ConnectionState() tls.ConnectionState { return c.tls.ConnectionState() }
+func (c *h2Conn) Context() context.Context             { return c.ctx }
+
+// splitALPN принимает соединения TLS-листенера ln, завершает рукопожатие и раздаёт их:
+// согласован h2 — в h2, иначе — в h1. Закрытие любого из двух листенеров закрывает ln.
+func splitALPN(ln net.Listener, handshakeTimeout time.Duration) (h1, h2 net.Listener) {
+	done := make(chan struct{})
+	var once sync.Once
+	closeAll := func() error {
+		var err error
+		once.Do(func() {
+			close(done)
+			err = ln.Close()
+		})
+		return err
+	}
+	l1 := &protoListener{addr: ln.Addr(), conns: make(chan net.Conn), done: done, close: closeAll}
+	l2 := &protoListener{addr: ln.Addr(), conns: make(chan net.Conn), done: done, close: closeAll}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					_ = closeAll()
+					return
+				}
+				log.Printf("[waiterd] accept error: %v", err)
+				time.Sleep(50 * time.Millisecond)
+				continue
+			}
+			go dispatchALPN(conn, handshakeTimeout, l1, l2, done)
+		}
+	}()
+	return l1, l2
+}
+
+func dispatchALPN(conn net.Conn, handshakeTimeout time.Duration, h1, h2 *protoListener, done <-chan struct{}) {
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		_ = conn.Close()
+		return
+	}
+	if handshakeTimeout > 0 {
+		_ = tc.SetDeadline(time.Now().Add(handshakeTimeout))
+	}
+	if err := tc.Handshake(); err != nil {
+		_ = tc.Close()
+		return
+	}
+	_ = tc.SetDeadline(time.Time{})
+
+	dst := h1
+	if tc.ConnectionState().NegotiatedProtocol == "h2" {
+		dst = h2
+	}
+	select {
+	case dst.conns <- tc:
+	case <-done:
+		_ = tc.Close()
+	}
+}
+
+// protoListener отдаёт соединения одного протокола из splitALPN.
+type protoListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+	done  <-chan struct{}
+	close func() error
+}
+
+func (l *protoListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *protoListener) Close() error   { return l.close() }
+func (l *protoListener) Addr() net.Addr { return l.addr }
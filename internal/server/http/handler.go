@@ -10,9 +10,12 @@ import (
 )
 
 // makeEndpointHandler решает, как обрабатывать endpoint: прямой backend или агрегация.
+// Endpoint с invalidates после успешного ответа сбрасывает связанные записи кэша.
 func makeEndpointHandler(services map[string]config.Service, ep config.Endpoint) fiber.Handler {
-	return func(c *fiber.Ctx) error {
+	return invalidateAfterSuccess(ep, func(c *fiber.Ctx) error {
 		switch {
+		case ep.Backend != nil && ep.WebSocket != nil:
+			return webSocketProxyHandler(services, ep)(c)
 		case ep.Backend != nil:
 			return httpBackendHandler(services, ep)(c)
 		case len(ep.Calls) > 0:
@@ -20,7 +23,7 @@ func makeEndpointHandler(services map[string]config.Service, ep config.Endpoint)
 		default:
 			return c.Status(http.StatusInternalServerError).SendString("endpoint is not configured (no backend/calls)")
 		}
-	}
+	})
 }
 
 // indexServices нормализует и индексирует сервисы по имени.
@@ -2,18 +2,15 @@ package httpserver
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
-
-	"waiterd/internal/config"
 )
 
 // copyHeaders копирует выбранные заголовки из Fiber запроса в http.Request.
 func copyHeaders(c *fiber.Ctx, req *http.Request) {
-	headerKeys := []string{"Content-Type", "Authorization", "Accept", "User-Agent", "X-Request-Id"}
+	headerKeys := []string{"Content-Type", "Authorization", "Accept", "User-Agent", "X-Request-Id", ClientCertSubjectHeader}
 	for _, hk := range headerKeys {
 		if v := c.Get(hk); v != "" {
 			req.Header.Set(hk, v)
@@ -21,6 +18,16 @@ func copyHeaders(c *fiber.Ctx, req *http.Request) {
 	}
 }
 
+// detachHeader copies header values out of fasthttp buffers: strings returned by fiber
+// are only valid until the handler returns, background work must not keep them.
+func detachHeader(h http.Header) {
+	for _, vals := range h {
+		for i := range vals {
+			vals[i] = strings.Clone(vals[i])
+		}
+	}
+}
+
 // copyRespHeaders копирует заголовки из http.Response в Fiber ctx.
 func copyRespHeaders(resp *http.Response, c *fiber.Ctx) {
 	for k, vals := range resp.Header {
@@ -118,13 +125,6 @@ func singleJoinPath(a, b string) string {
 	return a + "/" + b
 }
 
-func grpcNotImplementedHandler(svc config.Service, ep config.Endpoint) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		log.Printf("[waiterd] grpc transport for service=%s endpoint=%s %s not implemented yet", svc.Name, ep.Method, ep.Path)
-		return c.Status(http.StatusNotImplemented).SendString("gRPC transport not implemented yet")
-	}
-}
-
 // decodeWithMapping декодирует тело JSON и применяет mapping; если mapping пуст — возвращает json или string.
 func decodeWithMapping(body []byte, mapping map[string]string) any {
 	if len(mapping) == 0 {
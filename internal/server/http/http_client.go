@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
-	"strings"
 	"time"
 
 	"waiterd/internal/config"
@@ -23,11 +21,7 @@ func doHTTPCall(ctx context.Context, svc config.Service, method string, path str
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	baseURL := svc.ProxyURL
-	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
-		baseURL = "http://" + baseURL
-	}
-	base, err := url.Parse(baseURL)
+	base, err := parseBaseURL(svc.ProxyURL)
 	if err != nil {
 		return nil, 0, fmt.Errorf("invalid proxy_url %q: %w", svc.ProxyURL, err)
 	}
@@ -52,7 +46,9 @@ func doHTTPCall(ctx context.Context, svc config.Service, method string, path str
 		}
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	setDeadlineHeader(ctx, req.Header)
+
+	resp, err := clientFor(svc).Do(req)
 	if err != nil {
 		return nil, 0, fmt.Errorf("do request: %w", err)
 	}
@@ -0,0 +1,232 @@
+package httpserver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"waiterd/internal/config"
+)
+
+// XCacheHeader tells clients whether the response came from the gateway cache: HIT, STALE or MISS.
+const XCacheHeader = "X-Cache"
+
+// DefaultCacheMode is cache.mode: "ttl" (cache_ttl decides) or "http" (RFC 9111, upstream headers decide).
+var DefaultCacheMode = "ttl"
+
+func httpCacheMode(ep config.Endpoint) bool {
+	mode := ep.CacheMode
+	if mode == "" {
+		mode = DefaultCacheMode
+	}
+	return strings.EqualFold(strings.TrimSpace(mode), "http")
+}
+
+// cacheControl — разобранный Cache-Control: директива -> значение ("" у директив без значения).
+type cacheControl map[string]string
+
+func parseCacheControl(values []string) cacheControl {
+	cc := make(cacheControl)
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			name, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			cc[strings.ToLower(name)] = strings.Trim(val, `"`)
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, true // некорректное значение трактуем как «уже устарело»
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// requestCacheDirectives: lookup=false — клиент требует ответ от origin (no-cache, max-age=0),
+// store=false — ответ нельзя сохранять (no-store).
+func requestCacheDirectives(header func(string) string) (lookup, store bool) {
+	cc := parseCacheControl([]string{header("Cache-Control")})
+	lookup, store = true, true
+	if cc.has("no-cache") || cc.has("no-store") || strings.Contains(strings.ToLower(header("Pragma")), "no-cache") {
+		lookup = false
+	}
+	if d, ok := cc.seconds("max-age"); ok && d == 0 {
+		lookup = false
+	}
+	if cc.has("no-store") {
+		store = false
+	}
+	return lookup, store
+}
+
+// heuristicallyCacheable — статусы, которые RFC 9110 §15.1 разрешает кэшировать без явной свежести.
+var heuristicallyCacheable = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// httpFreshness реализует правила хранения и свежести RFC 9111 для разделяемого кэша.
+// heuristic (cache_ttl) используется, когда upstream не указал свежесть явно.
+// ok=false — ответ сохранять нельзя.
+func httpFreshness(resp *http.Response, hasAuth bool, heuristic time.Duration, now time.Time) (lifetime, age time.Duration, ok bool) {
+	h := resp.Header
+	cc := parseCacheControl(h.Values("Cache-Control"))
+	switch {
+	case cc.has("no-store"), cc.has("private"), cc.has("no-cache"):
+		return 0, 0, false
+	case len(h.Values("Set-Cookie")) > 0:
+		return 0, 0, false
+	case slices.Contains(varyNames(h), "*"):
+		return 0, 0, false
+	case hasAuth && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate"):
+		return 0, 0, false
+	}
+
+	date := now
+	if d, err := http.ParseTime(h.Get("Date")); err == nil {
+		date = d
+	}
+
+	if d, ok := cc.seconds("s-maxage"); ok {
+		lifetime = d
+	} else if d, ok := cc.seconds("max-age"); ok {
+		lifetime = d
+	} else if exp := h.Get("Expires"); exp != "" {
+		if t, err := http.ParseTime(exp); err == nil {
+			lifetime = t.Sub(date)
+		}
+	} else if heuristicallyCacheable[resp.StatusCode] {
+		lifetime = heuristic
+	}
+
+	if a, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil && a > 0 {
+		age = time.Duration(a) * time.Second
+	}
+	age = max(age, now.Sub(date))
+
+	if lifetime <= age {
+		return 0, 0, false
+	}
+	return lifetime, age, true
+}
+
+// varyNames returns the canonical, sorted header names listed in Vary.
+func varyNames(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, n := range strings.Split(v, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				names = append(names, http.CanonicalHeaderKey(n))
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// variantKey — ключ конкретного варианта ответа с учётом заголовков запроса из Vary.
+func variantKey(key string, vary []string, header func(string) string) string {
+	var b strings.Builder
+	b.WriteString(key)
+	b.WriteString("|vary")
+	for _, n := range vary {
+		b.WriteString(";" + n + "=" + header(n))
+	}
+	return b.String()
+}
+
+// proxyCacheStore решает, сохранять ли ответ upstream, и куда.
+type proxyCacheStore struct {
+	key       string
+	windows   cacheWindows
+	httpMode  bool
+	hasAuth   bool
+	reqHeader func(string) string // заголовки запроса для Vary
+	tags      []string            // cache_tags запроса
+}
+
+// entryFor builds an (empty-bodied) cache entry for resp; ok=false when resp must not be cached.
+func (s proxyCacheStore) entryFor(resp *http.Response) (entry *cachedHTTPResponse, vary []string, ok bool) {
+	if resp.StatusCode >= 500 {
+		return nil, nil, false
+	}
+	headers := extractCacheableHeaders(resp.Header)
+	if !s.httpMode {
+		return newCachedResponse(resp.StatusCode, headers, nil, s.windows.ttl), nil, true
+	}
+	now := time.Now()
+	lifetime, age, ok := httpFreshness(resp, s.hasAuth, s.windows.ttl, now)
+	if !ok {
+		return nil, nil, false
+	}
+	entry = newCachedResponse(resp.StatusCode, headers, nil, lifetime)
+	entry.StoredAt = now.Add(-age)
+	return entry, varyNames(resp.Header), true
+}
+
+// save stores entry; with Vary the base key holds a marker listing the headers,
+// and the response itself goes to the variant key.
+func (s proxyCacheStore) save(ctx context.Context, entry *cachedHTTPResponse, vary []string) {
+	ttl := entry.FreshFor - entry.age(time.Now()) + max(s.windows.swr, s.windows.sie) + validatorRetention(entry)
+	if ttl <= 0 {
+		return
+	}
+	if len(vary) == 0 {
+		storeCachedResponse(ctx, s.key, entry, ttl)
+	} else {
+		storeCachedResponse(ctx, s.key, &cachedHTTPResponse{VaryOn: vary}, ttl)
+		storeCachedResponse(ctx, variantKey(s.key, vary, s.reqHeader), entry, ttl)
+	}
+	// без записи-указателя варианты недоступны, поэтому тегируется только основной ключ
+	tagCached(ctx, s.key, s.tags, ttl)
+}
+
+// fetchAndSave выполняет запрос к upstream для фонового обновления и сохраняет ответ, если можно.
+// Если у старой записи есть ETag/Last-Modified, запрос условный и 304 лишь продлевает запись.
+func (s proxyCacheStore) fetchAndSave(ctx context.Context, client *http.Client, req *http.Request, old *cachedHTTPResponse) error {
+	clearConditionals(req.Header)
+	if hasValidators(old) {
+		setValidators(req.Header, old)
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && hasValidators(old) {
+		if entry, vary, ok := s.refreshed(old, resp); ok {
+			s.save(ctx, entry, vary)
+		}
+		return nil
+	}
+	entry, vary, ok := s.entryFor(resp)
+	if !ok {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxCacheableBodySize()))
+		return nil
+	}
+	body, complete, err := readUpTo(resp.Body, maxCacheableBodySize())
+	if err != nil || !complete {
+		return err
+	}
+	entry.Body = body
+	s.save(ctx, entry, vary)
+	return nil
+}
@@ -0,0 +1,136 @@
+package httpserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+func TestProxyHTTP_HTTPCacheMode(t *testing.T) {
+	t.Cleanup(func() {
+		CacheInstance = nil
+		DefaultCacheTTL = 0
+	})
+	CacheInstance = newMemoryCacheAdapter()
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/max-age":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			w.Header().Set("Age", "10")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/cookie":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Set-Cookie", "sid=1")
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept")
+		}
+		w.Write([]byte(r.URL.Path + ":" + r.Header.Get("Accept")))
+	}))
+	t.Cleanup(srv.Close)
+
+	services := indexServices([]config.Service{{Name: "svc", ProxyURL: srv.URL}})
+	app := fiber.New()
+	for _, p := range []string{"/max-age", "/no-store", "/private", "/cookie", "/vary"} {
+		app.Get(p, makeEndpointHandler(services, config.Endpoint{
+			Path: p, CacheMode: "http",
+			Backend: &config.Backend{Service: "svc", Path: p},
+		}))
+	}
+
+	get := func(path string, headers ...string) (string, *http.Response) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := app.Test(req, 2000)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return string(b), resp
+	}
+	hitsFor := func(path string, headers ...string) int32 {
+		t.Helper()
+		before := hits.Load()
+		get(path, headers...)
+		get(path, headers...)
+		return hits.Load() - before
+	}
+
+	// свежесть из max-age, без cache_ttl; Age учитывает возраст у upstream
+	if _, resp := get("/max-age"); resp.Header.Get(XCacheHeader) != "MISS" {
+		t.Fatalf("first X-Cache=%q", resp.Header.Get(XCacheHeader))
+	}
+	_, resp := get("/max-age")
+	if resp.Header.Get(XCacheHeader) != "HIT" || resp.Header.Get(fiber.HeaderAge) != "10" {
+		t.Fatalf("second X-Cache=%q Age=%q", resp.Header.Get(XCacheHeader), resp.Header.Get(fiber.HeaderAge))
+	}
+	if n := hitsFor("/max-age", "Cache-Control", "no-cache"); n != 2 {
+		t.Fatalf("request no-cache must bypass cache, hits=%d", n)
+	}
+
+	for _, p := range []string{"/no-store", "/private", "/cookie"} {
+		if n := hitsFor(p); n != 2 {
+			t.Fatalf("%s must not be cached, hits=%d", p, n)
+		}
+	}
+
+	// Vary: отдельная запись на каждое значение Accept
+	if n := hitsFor("/vary", "Accept", "text/plain"); n != 1 {
+		t.Fatalf("vary text/plain hits=%d", n)
+	}
+	if body, _ := get("/vary", "Accept", "text/html"); body != "/vary:text/html" {
+		t.Fatalf("vary text/html body=%q", body)
+	}
+	if body, resp := get("/vary", "Accept", "text/plain"); body != "/vary:text/plain" || resp.Header.Get(XCacheHeader) != "HIT" {
+		t.Fatalf("vary text/plain body=%q X-Cache=%q", body, resp.Header.Get(XCacheHeader))
+	}
+}
+
+func TestHTTPFreshness(t *testing.T) {
+	now := time.Now()
+	mk := func(status int, kv ...string) *http.Response {
+		h := make(http.Header)
+		for i := 0; i+1 < len(kv); i += 2 {
+			h.Add(kv[i], kv[i+1])
+		}
+		return &http.Response{StatusCode: status, Header: h}
+	}
+	cases := []struct {
+		name     string
+		resp     *http.Response
+		auth     bool
+		lifetime time.Duration
+		ok       bool
+	}{
+		{"s-maxage wins", mk(200, "Cache-Control", "max-age=10, s-maxage=30"), false, 30 * time.Second, true},
+		{"expires", mk(200, "Date", now.UTC().Format(http.TimeFormat), "Expires", now.Add(time.Minute).UTC().Format(http.TimeFormat)), false, time.Minute, true},
+		{"heuristic", mk(200), false, 5 * time.Second, true},
+		{"no heuristic for 302", mk(302), false, 0, false},
+		{"auth needs public", mk(200, "Cache-Control", "max-age=10"), true, 0, false},
+		{"auth with public", mk(200, "Cache-Control", "public, max-age=10"), true, 10 * time.Second, true},
+		{"vary star", mk(200, "Cache-Control", "max-age=10", "Vary", "*"), false, 0, false},
+		{"already stale", mk(200, "Cache-Control", "max-age=10", "Age", "20"), false, 0, false},
+	}
+	for _, tc := range cases {
+		lifetime, _, ok := httpFreshness(tc.resp, tc.auth, 5*time.Second, now)
+		if ok != tc.ok || (ok && (lifetime-tc.lifetime).Abs() > time.Second) {
+			t.Errorf("%s: lifetime=%s ok=%v, want %s %v", tc.name, lifetime, ok, tc.lifetime, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package httpserver
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+// routeCandidate is one endpoint competing for the same method+path.
+type routeCandidate struct {
+	ep      config.Endpoint
+	order   int
+	handler fiber.Handler
+}
+
+// sortRouteCandidates orders endpoints sharing a route deterministically:
+// higher priority first, then more specific match (more conditions), then config order.
+func sortRouteCandidates(cands []routeCandidate) {
+	sort.SliceStable(cands, func(i, j int) bool {
+		a, b := cands[i], cands[j]
+		if a.ep.Priority != b.ep.Priority {
+			return a.ep.Priority > b.ep.Priority
+		}
+		if sa, sb := matchSpecificity(a.ep.Match), matchSpecificity(b.ep.Match); sa != sb {
+			return sa > sb
+		}
+		return a.order < b.order
+	})
+}
+
+func matchSpecificity(m *config.Match) int {
+	if m == nil {
+		return 0
+	}
+	n := len(m.Headers) + len(m.Query) + len(m.Cookies)
+	if m.Host != "" {
+		n++
+	}
+	return n
+}
+
+// dispatchRoute returns a handler that serves the first candidate whose match conditions hold.
+// Если не подошёл ни один, запрос уходит дальше по цепочке fiber (следующие маршруты, 404 по умолчанию).
+func dispatchRoute(cands []routeCandidate) fiber.Handler {
+	if len(cands) == 1 && cands[0].ep.Match == nil {
+		return cands[0].handler
+	}
+	return func(c *fiber.Ctx) error {
+		for _, rc := range cands {
+			if routeMatches(c, rc.ep.Match) {
+				return rc.handler(c)
+			}
+		}
+		return c.Next()
+	}
+}
+
+func routeMatches(c *fiber.Ctx, m *config.Match) bool {
+	if m == nil {
+		return true
+	}
+	if m.Host != "" && !hostMatches(m.Host, c.Hostname()) {
+		return false
+	}
+	for k, want := range m.Headers {
+		if !valueMatches(want, c.Get(k)) {
+			return false
+		}
+	}
+	for k, want := range m.Query {
+		if !valueMatches(want, c.Query(k)) {
+			return false
+		}
+	}
+	for k, want := range m.Cookies {
+		if !valueMatches(want, c.Cookies(k)) {
+			return false
+		}
+	}
+	return true
+}
+
+func valueMatches(want, got string) bool {
+	if want == "*" {
+		return got != ""
+	}
+	return got == want
+}
+
+// hostMatches compares host names case-insensitively, ignoring the port.
+// "*.example.com" matches exactly one extra label ("api.example.com", not "example.com").
+func hostMatches(pattern, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	pattern, host = strings.ToLower(pattern), strings.ToLower(host)
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		label, found := strings.CutSuffix(host, suffix)
+		return found && label != "" && !strings.Contains(label, ".")
+	}
+	return pattern == host
+}
@@ -1,51 +1,151 @@
 package httpserver
 
 import (
+	"container/list"
 	"context"
+	"hash/maphash"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// memoryCacheAdapter is a small in-memory TTL cache implementing cacheInterface.
+// memoryCacheAdapter is an in-memory TTL cache implementing cacheInterface.
 // It's used when cache.driver=memory.
-// NOTE: It's intentionally simple (single process, best-effort cleanup).
+// Keys are spread over shards, each with its own lock and LRU list. Limits on entries and
+// bytes are split evenly between the shards: a write evicts the least recently used entries
+// of its own shard only, so writers never wait on other shards.
+// A background janitor drops expired entries that are never read again.
 // It is safe for concurrent use.
-
 type memoryCacheAdapter struct {
-	mu    sync.RWMutex
-	items map[string]memItem
+	shards     []*memShard
+	seed       maphash.Seed
+	maxEntries int64 // 0 — без ограничения
+	maxBytes   int64 // 0 — без ограничения
+	// доля лимитов на один шард
+	shardMaxEntries int64
+	shardMaxBytes   int64
+
+	entries atomic.Int64
+	bytes   atomic.Int64
+
+	hits, misses, evictions, expirations atomic.Int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type memShard struct {
+	mu    sync.Mutex
+	items map[string]*list.Element // -> *memItem
+	lru   *list.List               // front — недавно использованные
+	tags  map[string]map[string]struct{}
+
+	entries, bytes int64
 }
 
 type memItem struct {
-	b   []byte
-	exp time.Time
+	key  string
+	b    []byte
+	exp  time.Time
+	tags []string
+}
+
+func (it *memItem) size() int64 { return int64(len(it.key) + len(it.b)) }
+
+func (it *memItem) expired(now time.Time) bool { return !it.exp.IsZero() && now.After(it.exp) }
+
+// memoryCacheStats — снимок метрик для /admin/cache/stats.
+type memoryCacheStats struct {
+	Entries     int64 `json:"entries"`
+	Bytes       int64 `json:"bytes"`
+	MaxEntries  int64 `json:"max_entries,omitempty"`
+	MaxBytes    int64 `json:"max_bytes,omitempty"`
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	Evictions   int64 `json:"evictions"`
+	Expirations int64 `json:"expirations"`
 }
 
+const (
+	memoryCacheShards = 16
+	// Меньше этого на шард лимиты не делятся: маленький кэш живёт в нескольких шардах (или одном),
+	// чтобы доля шарда не выродилась в пару записей.
+	minShardEntries = 64
+	minShardBytes   = 1 << 20
+)
+
+// memoryShardCount — число шардов для лимитов maxEntries/maxBytes.
+func memoryShardCount(maxEntries, maxBytes int64) int64 {
+	n := int64(memoryCacheShards)
+	if maxEntries > 0 {
+		n = min(n, max(1, maxEntries/minShardEntries))
+	}
+	if maxBytes > 0 {
+		n = min(n, max(1, maxBytes/minShardBytes))
+	}
+	return n
+}
+
+// newMemoryCacheAdapter returns an unbounded cache without a janitor (expired keys go away on read).
 func newMemoryCacheAdapter() *memoryCacheAdapter {
-	return &memoryCacheAdapter{items: make(map[string]memItem)}
+	return newBoundedMemoryCache(0, 0, 0)
+}
+
+// newBoundedMemoryCache limits the cache to maxEntries/maxBytes (0 — no limit) and, with
+// cleanupInterval > 0, starts a janitor that must be stopped with Close.
+func newBoundedMemoryCache(maxEntries, maxBytes int64, cleanupInterval time.Duration) *memoryCacheAdapter {
+	n := memoryShardCount(maxEntries, maxBytes)
+	m := &memoryCacheAdapter{
+		shards:          make([]*memShard, n),
+		seed:            maphash.MakeSeed(),
+		maxEntries:      maxEntries,
+		maxBytes:        maxBytes,
+		shardMaxEntries: maxEntries / n,
+		shardMaxBytes:   maxBytes / n,
+		stop:            make(chan struct{}),
+	}
+	for i := range m.shards {
+		m.shards[i] = &memShard{
+			items: make(map[string]*list.Element),
+			lru:   list.New(),
+			tags:  make(map[string]map[string]struct{}),
+		}
+	}
+	if cleanupInterval > 0 {
+		go m.janitor(cleanupInterval)
+	}
+	return m
+}
+
+func (m *memoryCacheAdapter) shardIndex(key string) int {
+	return int(maphash.String(m.seed, key) % uint64(len(m.shards)))
 }
 
 func (m *memoryCacheAdapter) Get(ctx context.Context, key string) ([]byte, bool, error) {
 	_ = ctx
-	m.mu.RLock()
-	it, ok := m.items[key]
-	m.mu.RUnlock()
+	s := m.shards[m.shardIndex(key)]
+	s.mu.Lock()
+	el, ok := s.items[key]
 	if !ok {
+		s.mu.Unlock()
+		m.misses.Add(1)
 		return nil, false, nil
 	}
-	if !it.exp.IsZero() && time.Now().After(it.exp) {
-		m.mu.Lock()
-		// re-check
-		it2, ok2 := m.items[key]
-		if ok2 && !it2.exp.IsZero() && time.Now().After(it2.exp) {
-			delete(m.items, key)
-		}
-		m.mu.Unlock()
+	it := el.Value.(*memItem)
+	if it.expired(time.Now()) {
+		m.removeLocked(s, el)
+		s.mu.Unlock()
+		m.expirations.Add(1)
+		m.misses.Add(1)
 		return nil, false, nil
 	}
+	s.lru.MoveToFront(el)
 	// return a copy to avoid external mutation
 	out := make([]byte, len(it.b))
 	copy(out, it.b)
+	s.mu.Unlock()
+	m.hits.Add(1)
 	return out, true, nil
 }
 
@@ -60,14 +160,212 @@ func (m *memoryCacheAdapter) Set(ctx context.Context, key string, data []byte, t
 	}
 	b := make([]byte, len(data))
 	copy(b, data)
-	m.mu.Lock()
-	m.items[key] = memItem{b: b, exp: exp}
-	m.mu.Unlock()
+	it := &memItem{key: key, b: b, exp: exp}
+	if m.shardMaxBytes > 0 && it.size() > m.shardMaxBytes {
+		// не поместится в шард никогда — не вытесняем ради него весь шард, но и прежнее значение
+		// ключа не оставляем: оно устарело, читатель получит промах
+		_, _ = m.Delete(ctx, key)
+		return nil
+	}
+
+	s := m.shards[m.shardIndex(key)]
+	s.mu.Lock()
+	if el, ok := s.items[key]; ok {
+		old := el.Value.(*memItem)
+		it.tags = old.tags
+		s.bytes += it.size() - old.size()
+		m.bytes.Add(it.size() - old.size())
+		el.Value = it
+		s.lru.MoveToFront(el)
+	} else {
+		s.items[key] = s.lru.PushFront(it)
+		s.entries++
+		s.bytes += it.size()
+		m.entries.Add(1)
+		m.bytes.Add(it.size())
+	}
+	m.evictLocked(s)
+	s.mu.Unlock()
 	return nil
 }
 
+// evictLocked вытесняет самые давно использованные записи шарда, пока он не уложится в свою долю
+// лимитов. Только что записанная запись в начале LRU и в долю помещается, поэтому не вытесняется.
+// s.mu must be held.
+func (m *memoryCacheAdapter) evictLocked(s *memShard) {
+	for (m.shardMaxEntries > 0 && s.entries > m.shardMaxEntries) ||
+		(m.shardMaxBytes > 0 && s.bytes > m.shardMaxBytes) {
+		el := s.lru.Back()
+		if el == nil {
+			return
+		}
+		m.removeLocked(s, el)
+		m.evictions.Add(1)
+	}
+}
+
+// removeLocked deletes the entry and unlinks it from its tags; s.mu must be held.
+func (m *memoryCacheAdapter) removeLocked(s *memShard, el *list.Element) {
+	it := el.Value.(*memItem)
+	s.lru.Remove(el)
+	delete(s.items, it.key)
+	s.entries--
+	s.bytes -= it.size()
+	m.entries.Add(-1)
+	m.bytes.Add(-it.size())
+	for _, tag := range it.tags {
+		if keys := s.tags[tag]; keys != nil {
+			delete(keys, it.key)
+			if len(keys) == 0 {
+				delete(s.tags, tag)
+			}
+		}
+	}
+}
+
+func (m *memoryCacheAdapter) janitor(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-t.C:
+			m.deleteExpired()
+		}
+	}
+}
+
+func (m *memoryCacheAdapter) deleteExpired() {
+	now := time.Now()
+	for _, s := range m.shards {
+		s.mu.Lock()
+		for _, el := range s.items {
+			if el.Value.(*memItem).expired(now) {
+				m.removeLocked(s, el)
+				m.expirations.Add(1)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Close stops the janitor.
+func (m *memoryCacheAdapter) Close() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+func (m *memoryCacheAdapter) Stats() memoryCacheStats {
+	return memoryCacheStats{
+		Entries:     m.entries.Load(),
+		Bytes:       m.bytes.Load(),
+		MaxEntries:  m.maxEntries,
+		MaxBytes:    m.maxBytes,
+		Hits:        m.hits.Load(),
+		Misses:      m.misses.Load(),
+		Evictions:   m.evictions.Load(),
+		Expirations: m.expirations.Load(),
+	}
+}
+
 func (m *memoryCacheAdapter) Clear() {
-	m.mu.Lock()
-	clear(m.items)
-	m.mu.Unlock()
+	for _, s := range m.shards {
+		s.mu.Lock()
+		for _, el := range s.items {
+			m.removeLocked(s, el)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (m *memoryCacheAdapter) Delete(ctx context.Context, keys ...string) (int, error) {
+	_ = ctx
+	n := 0
+	for _, k := range keys {
+		s := m.shards[m.shardIndex(k)]
+		s.mu.Lock()
+		if el, ok := s.items[k]; ok {
+			m.removeLocked(s, el)
+			n++
+		}
+		s.mu.Unlock()
+	}
+	return n, nil
+}
+
+func (m *memoryCacheAdapter) DeleteMatch(ctx context.Context, pattern string) (int, error) {
+	_ = ctx
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, s := range m.shards {
+		s.mu.Lock()
+		for k, el := range s.items {
+			if re.MatchString(k) {
+				m.removeLocked(s, el)
+				n++
+			}
+		}
+		s.mu.Unlock()
+	}
+	return n, nil
+}
+
+// Tag links an existing key to tags; the link lives as long as the key.
+func (m *memoryCacheAdapter) Tag(ctx context.Context, key string, tags []string, ttl time.Duration) error {
+	_, _ = ctx, ttl
+	s := m.shards[m.shardIndex(key)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	it := el.Value.(*memItem)
+	for _, tag := range tags {
+		if slices.Contains(it.tags, tag) {
+			continue
+		}
+		it.tags = append(it.tags, tag)
+		if s.tags[tag] == nil {
+			s.tags[tag] = make(map[string]struct{})
+		}
+		s.tags[tag][key] = struct{}{}
+	}
+	return nil
+}
+
+func (m *memoryCacheAdapter) TagKeys(ctx context.Context, tags ...string) ([]string, error) {
+	_ = ctx
+	var keys []string
+	for _, s := range m.shards {
+		s.mu.Lock()
+		for _, tag := range tags {
+			for k := range s.tags[tag] {
+				keys = append(keys, k)
+			}
+		}
+		s.mu.Unlock()
+	}
+	return keys, nil
+}
+
+func (m *memoryCacheAdapter) DeleteTags(ctx context.Context, tags ...string) (int, error) {
+	_ = ctx
+	n := 0
+	for _, s := range m.shards {
+		s.mu.Lock()
+		for _, tag := range tags {
+			for k := range s.tags[tag] {
+				if el, ok := s.items[k]; ok {
+					m.removeLocked(s, el)
+					n++
+				}
+			}
+		}
+		s.mu.Unlock()
+	}
+	return n, nil
 }
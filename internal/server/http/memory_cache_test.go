@@ -2,6 +2,8 @@ package httpserver
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 )
@@ -31,3 +33,138 @@ func TestMemoryCacheAdapter_TTL(t *testing.T) {
 		t.Fatalf("expected expired key")
 	}
 }
+
+func TestMemoryCacheAdapter_LRUEviction(t *testing.T) {
+	ctx := context.Background()
+	m := newBoundedMemoryCache(3, 0, 0)
+
+	for _, k := range []string{"a", "b", "c"} {
+		_ = m.Set(ctx, k, []byte(k), time.Minute)
+	}
+	// "a" использован недавно — вытесняется "b"
+	if _, ok, _ := m.Get(ctx, "a"); !ok {
+		t.Fatal("a must be present")
+	}
+	_ = m.Set(ctx, "d", []byte("d"), time.Minute)
+
+	st := m.Stats()
+	if st.Entries != 3 || st.Evictions != 1 {
+		t.Fatalf("stats=%+v", st)
+	}
+	for _, k := range []string{"a", "c", "d"} {
+		if _, ok, _ := m.Get(ctx, k); !ok {
+			t.Fatalf("%s must be present", k)
+		}
+	}
+	if _, ok, _ := m.Get(ctx, "b"); ok {
+		t.Fatal("b must be evicted")
+	}
+}
+
+func TestMemoryCacheAdapter_MaxBytes(t *testing.T) {
+	ctx := context.Background()
+	m := newBoundedMemoryCache(0, 100, 0)
+
+	for i := range 10 {
+		_ = m.Set(ctx, fmt.Sprintf("k%d", i), make([]byte, 30), time.Minute)
+	}
+	if st := m.Stats(); st.Bytes > 100 || st.Entries != 3 || st.Evictions != 7 {
+		t.Fatalf("stats=%+v", st)
+	}
+	// больше лимита целиком — не сохраняется и ничего не вытесняет
+	_ = m.Set(ctx, "huge", make([]byte, 200), time.Minute)
+	if _, ok, _ := m.Get(ctx, "huge"); ok || m.Stats().Entries != 3 {
+		t.Fatalf("oversized entry stored, stats=%+v", m.Stats())
+	}
+	// перезапись ключа учитывает разницу размеров
+	_ = m.Set(ctx, "k9", make([]byte, 10), time.Minute)
+	if st := m.Stats(); st.Bytes != 2*32+12 {
+		t.Fatalf("bytes after overwrite=%d", st.Bytes)
+	}
+	// слишком большое новое значение удаляет старое, а не оставляет его
+	_ = m.Set(ctx, "k9", make([]byte, 200), time.Minute)
+	if _, ok, _ := m.Get(ctx, "k9"); ok {
+		t.Fatal("stale value kept after oversized overwrite")
+	}
+	if st := m.Stats(); st.Entries != 2 || st.Bytes != 2*32 {
+		t.Fatalf("stats after oversized overwrite=%+v", st)
+	}
+}
+
+func TestMemoryCacheAdapter_Janitor(t *testing.T) {
+	ctx := context.Background()
+	m := newBoundedMemoryCache(0, 0, 5*time.Millisecond)
+	t.Cleanup(m.Close)
+
+	_ = m.Set(ctx, "short", []byte("v"), 10*time.Millisecond)
+	_ = m.Set(ctx, "long", []byte("v"), time.Minute)
+
+	deadline := time.Now().Add(time.Second)
+	for m.Stats().Entries != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("janitor did not remove expired entry, stats=%+v", m.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if st := m.Stats(); st.Expirations != 1 || st.Bytes != int64(len("long")+1) {
+		t.Fatalf("stats=%+v", st)
+	}
+}
+
+func TestMemoryCacheAdapter_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	m := newBoundedMemoryCache(50, 0, time.Millisecond)
+	t.Cleanup(m.Close)
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				k := fmt.Sprintf("k%d", (g*31+i)%200)
+				_ = m.Set(ctx, k, []byte(k), time.Duration(i%3)*time.Millisecond+time.Millisecond)
+				_, _, _ = m.Get(ctx, k)
+				if i%50 == 0 {
+					_ = m.Tag(ctx, k, []string{"t"}, time.Minute)
+					_, _ = m.DeleteTags(ctx, "t")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if st := m.Stats(); st.Entries > 50 || st.Entries < 0 || st.Bytes < 0 {
+		t.Fatalf("stats=%+v", st)
+	}
+}
+
+func TestMemoryCacheAdapter_PerShardBudget(t *testing.T) {
+	for _, tc := range []struct {
+		entries, bytes, want int64
+	}{
+		{0, 0, memoryCacheShards},
+		{3, 0, 1},
+		{100000, 256 << 20, memoryCacheShards},
+		{4 * minShardEntries, 0, 4},
+		{0, 2 * minShardBytes, 2},
+	} {
+		if got := memoryShardCount(tc.entries, tc.bytes); got != tc.want {
+			t.Fatalf("memoryShardCount(%d, %d)=%d want %d", tc.entries, tc.bytes, got, tc.want)
+		}
+	}
+
+	ctx := context.Background()
+	m := newBoundedMemoryCache(memoryCacheShards*minShardEntries, 0, 0)
+	for i := range 5000 {
+		_ = m.Set(ctx, fmt.Sprintf("k%d", i), []byte("v"), time.Minute)
+	}
+	// каждый шард держит свою долю, поэтому и весь кэш — не больше лимита
+	for i, s := range m.shards {
+		if s.entries > m.shardMaxEntries || int64(s.lru.Len()) != s.entries {
+			t.Fatalf("shard %d: entries=%d lru=%d budget=%d", i, s.entries, s.lru.Len(), m.shardMaxEntries)
+		}
+	}
+	if st := m.Stats(); st.Entries > st.MaxEntries || st.Entries+st.Evictions != 5000 {
+		t.Fatalf("stats=%+v", st)
+	}
+}
@@ -0,0 +1,293 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+// mirrorSlots ограничивает число одновременных теневых запросов каждого mirror.
+var mirrorSlots sync.Map // *config.Mirror -> chan struct{}
+
+// MirrorHeader marks shadow requests so the secondary service can tell them apart.
+const MirrorHeader = "X-Waiterd-Mirror"
+
+// shadowTarget is a resolved backend.mirror.
+type shadowTarget struct {
+	cfg *config.Mirror
+	svc config.Service
+}
+
+// mirrorFor resolves the mirror service of an endpoint; nil when mirroring is off or misconfigured.
+func mirrorFor(services map[string]config.Service, ep config.Endpoint) *shadowTarget {
+	if ep.Backend == nil || ep.Backend.Mirror == nil || ep.Streaming {
+		return nil
+	}
+	svc, ok := services[ep.Backend.Mirror.Service]
+	if !ok || (svc.Transport != "" && svc.Transport != "http") {
+		return nil
+	}
+	return &shadowTarget{cfg: ep.Backend.Mirror, svc: svc}
+}
+
+func (m *shadowTarget) slots() chan struct{} {
+	if v, ok := mirrorSlots.Load(m.cfg); ok {
+		return v.(chan struct{})
+	}
+	n := m.cfg.MaxConcurrent
+	if n <= 0 {
+		n = 16
+	}
+	v, _ := mirrorSlots.LoadOrStore(m.cfg, make(chan struct{}, n))
+	return v.(chan struct{})
+}
+
+func (m *shadowTarget) sampled() bool {
+	p := m.cfg.Percent
+	return p <= 0 || p >= 100 || rand.Float64()*100 < p
+}
+
+// mirrorResult — итог ответа (основного или теневого) для сравнения.
+type mirrorResult struct {
+	status int
+	size   int64
+	sum    [sha256.Size]byte
+	err    error
+}
+
+// shadowCall is one mirrored request; body() copies the request body while it streams
+// to the primary, tee()/failed() hand over the primary response for diffing.
+type shadowCall struct {
+	limit     int64
+	bodyCh    chan mirrorBody
+	bodyOnce  sync.Once
+	primaryCh chan mirrorResult
+}
+
+// mirrorBody — тело запроса для теневой копии; ok=false — копию не отправлять.
+type mirrorBody struct {
+	data []byte
+	ok   bool
+}
+
+func (s *shadowCall) sendBody(data []byte, ok bool) {
+	s.bodyOnce.Do(func() { s.bodyCh <- mirrorBody{data: data, ok: ok} })
+}
+
+// start копирует запрос (всё, что нужно, берётся из c синхронно) и отправляет копию в фоне,
+// когда тело целиком ушло в основной upstream (см. body): заранее тело не читается.
+// Возвращает nil, если запрос не попал в выборку, тело заведомо слишком большое или все слоты
+// заняты — основной запрос от этого никогда не ждёт.
+func (m *shadowTarget) start(c *fiber.Ctx, method, path, rawQuery string) *shadowCall {
+	if m == nil || !m.sampled() {
+		return nil
+	}
+	method, rawQuery = strings.Clone(method), strings.Clone(rawQuery)
+	logReq := reqLogger(c)
+
+	limit := m.cfg.MaxBodyBytes
+	if limit <= 0 {
+		limit = maxCacheableBodySize()
+	}
+	if cl := c.Request().Header.ContentLength(); int64(cl) > limit {
+		logReq("[waiterd][mirror] skip svc=%s: body too large", m.svc.Name)
+		return nil
+	}
+
+	slots := m.slots()
+	select {
+	case slots <- struct{}{}:
+	default:
+		logReq("[waiterd][mirror] drop svc=%s: %d requests in flight", m.svc.Name, cap(slots))
+		return nil
+	}
+
+	base, err := parseBaseURL(m.svc.ProxyURL)
+	if err != nil {
+		<-slots
+		logReq("[waiterd][mirror] invalid proxy_url for %s: %v", m.svc.Name, err)
+		return nil
+	}
+	target := *base
+	target.Path = singleJoinPath(base.Path, path)
+	target.RawQuery = rawQuery
+
+	req, err := http.NewRequest(method, target.String(), http.NoBody)
+	if err != nil {
+		<-slots
+		return nil
+	}
+	copyHeaders(c, req)
+	detachHeader(req.Header)
+	req.Header.Set(MirrorHeader, "1")
+	parent := context.WithoutCancel(c.UserContext())
+
+	call := &shadowCall{limit: limit, bodyCh: make(chan mirrorBody, 1), primaryCh: make(chan mirrorResult, 1)}
+	go func() {
+		defer func() { <-slots }()
+
+		body := <-call.bodyCh
+		if !body.ok {
+			logReq("[waiterd][mirror] skip svc=%s: request body not fully sent to primary or too large", m.svc.Name)
+			return
+		}
+		if len(body.data) > 0 {
+			req.Body = io.NopCloser(bytes.NewReader(body.data))
+			req.ContentLength = int64(len(body.data))
+		}
+		ctx, cancel := context.WithTimeout(parent, serviceTimeout(m.svc))
+		defer cancel()
+
+		shadow := mirrorResult{}
+		resp, err := clientFor(m.svc).Do(req.WithContext(ctx))
+		if err != nil {
+			shadow.err = err
+		} else {
+			shadow.status = resp.StatusCode
+			h := sha256.New()
+			shadow.size, shadow.err = io.Copy(h, resp.Body)
+			copy(shadow.sum[:], h.Sum(nil))
+			_ = resp.Body.Close()
+		}
+		if shadow.err != nil {
+			logReq("[waiterd][mirror] svc=%s %s error: %v", m.svc.Name, target.Path, shadow.err)
+		}
+		if !m.cfg.LogDiff {
+			return
+		}
+
+		var primary mirrorResult
+		select {
+		case primary = <-call.primaryCh:
+		case <-time.After(time.Minute):
+			return
+		}
+		switch {
+		case primary.err != nil || shadow.err != nil:
+		case primary.status != shadow.status:
+			logReq("[waiterd][mirror] diff svc=%s %s %s: status %d vs shadow %d", m.svc.Name, method, target.Path, primary.status, shadow.status)
+		case primary.sum != shadow.sum:
+			logReq("[waiterd][mirror] diff svc=%s %s %s: body %d bytes vs shadow %d bytes", m.svc.Name, method, target.Path, primary.size, shadow.size)
+		}
+	}()
+	return call
+}
+
+// body wraps the primary request body: bytes are copied (up to the mirror limit) while the
+// primary upstream reads them, and the shadow request is sent once the body is complete.
+// Transport always closes the request body, so the shadow goroutine is released on every path.
+func (s *shadowCall) body(r io.Reader, size int64) io.Reader {
+	if s == nil {
+		return r
+	}
+	if size == 0 || r == http.NoBody {
+		s.sendBody(nil, true)
+		return r
+	}
+	return &mirrorBodyTee{r: r, size: size, call: s}
+}
+
+type mirrorBodyTee struct {
+	r    io.Reader
+	size int64 // -1 — длина неизвестна
+	call *shadowCall
+
+	mu   sync.Mutex
+	buf  []byte
+	n    int64
+	over bool
+	eof  bool
+}
+
+func (t *mirrorBodyTee) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.mu.Lock()
+	t.n += int64(n)
+	if !t.over {
+		if t.n > t.call.limit {
+			t.over, t.buf = true, nil
+		} else {
+			t.buf = append(t.buf, p[:n]...)
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		t.eof = true
+	}
+	t.mu.Unlock()
+	return n, err
+}
+
+func (t *mirrorBodyTee) Close() error {
+	t.mu.Lock()
+	complete := !t.over && (t.eof || (t.size >= 0 && t.n == t.size))
+	buf := t.buf
+	t.mu.Unlock()
+	t.call.sendBody(buf, complete)
+	if c, ok := t.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// failed reports that the primary request produced no response.
+func (s *shadowCall) failed(err error) {
+	if s != nil {
+		s.sendBody(nil, false)
+		s.primaryCh <- mirrorResult{err: err}
+	}
+}
+
+// tee wraps the primary response body: it is hashed while it streams to the client
+// and the result is handed to the shadow goroutine on Close.
+func (s *shadowCall) tee(resp *http.Response) io.ReadCloser {
+	if s == nil {
+		return resp.Body
+	}
+	return &mirrorTee{ReadCloser: resp.Body, status: resp.StatusCode, h: sha256.New(), done: s.primaryCh}
+}
+
+type mirrorTee struct {
+	io.ReadCloser
+	status int
+	h      hash.Hash
+	n      int64
+	eof    bool
+	once   sync.Once
+	done   chan<- mirrorResult
+}
+
+func (t *mirrorTee) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.h.Write(p[:n])
+	t.n += int64(n)
+	if errors.Is(err, io.EOF) {
+		t.eof = true
+	}
+	return n, err
+}
+
+func (t *mirrorTee) Close() error {
+	err := t.ReadCloser.Close()
+	t.once.Do(func() {
+		res := mirrorResult{status: t.status, size: t.n}
+		if t.eof {
+			copy(res.sum[:], t.h.Sum(nil))
+		} else {
+			res.err = errors.New("primary body not fully read")
+		}
+		t.done <- res
+	})
+	return err
+}
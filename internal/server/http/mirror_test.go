@@ -0,0 +1,187 @@
+package httpserver
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestProxyHTTP_MirrorsRequests(t *testing.T) {
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1"))
+	}))
+	t.Cleanup(primary.Close)
+
+	type seenReq struct{ body, query, mark string }
+	shadowSeen := make(chan seenReq, 1)
+	release := make(chan struct{})
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		shadowSeen <- seenReq{body: string(b), query: r.URL.RawQuery, mark: r.Header.Get(MirrorHeader)}
+		<-release
+		w.Write([]byte("v2"))
+	}))
+	t.Cleanup(shadow.Close)
+	t.Cleanup(func() { close(release) })
+
+	services := indexServices([]config.Service{
+		{Name: "orders", ProxyURL: primary.URL},
+		{Name: "orders-next", ProxyURL: shadow.URL},
+	})
+	ep := config.Endpoint{Path: "/orders", Method: http.MethodPost, Backend: &config.Backend{
+		Service: "orders",
+		Path:    "/orders",
+		Mirror:  &config.Mirror{Service: "orders-next", MaxConcurrent: 1, LogDiff: true},
+	}}
+
+	app := fiber.New(fiber.Config{StreamRequestBody: true})
+	app.Post("/orders", makeEndpointHandler(services, ep))
+
+	post := func() string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/orders?x=1", strings.NewReader(`{"id":1}`))
+		resp, err := app.Test(req, 2000)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	// основной ответ не ждёт медленный теневой сервис
+	if got := post(); got != "v1" {
+		t.Fatalf("primary body=%q", got)
+	}
+	select {
+	case s := <-shadowSeen:
+		if s.body != `{"id":1}` || s.query != "x=1" || s.mark != "1" {
+			t.Fatalf("shadow got %+v", s)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("shadow request not sent")
+	}
+
+	// единственный слот занят — следующий запрос не зеркалируется
+	if got := post(); got != "v1" {
+		t.Fatalf("primary body=%q", got)
+	}
+	if !strings.Contains(logs.String(), "[waiterd][mirror] drop") {
+		t.Fatalf("expected dropped mirror, logs:\n%s", logs.String())
+	}
+
+	release <- struct{}{}
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(logs.String(), "[waiterd][mirror] diff") {
+		if time.Now().After(deadline) {
+			t.Fatalf("diff not logged, logs:\n%s", logs.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProxyHTTP_MirrorCopiesStreamedBody(t *testing.T) {
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	primarySeen := make(chan int, 2)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		primarySeen <- len(b)
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(primary.Close)
+	shadowSeen := make(chan string, 2)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		shadowSeen <- string(b)
+	}))
+	t.Cleanup(shadow.Close)
+
+	services := indexServices([]config.Service{
+		{Name: "orders", ProxyURL: primary.URL},
+		{Name: "orders-next", ProxyURL: shadow.URL},
+	})
+	ep := config.Endpoint{Path: "/orders", Method: http.MethodPost, Backend: &config.Backend{
+		Service: "orders",
+		Path:    "/orders",
+		Mirror:  &config.Mirror{Service: "orders-next", MaxBodyBytes: 16},
+	}}
+	app := fiber.New(fiber.Config{StreamRequestBody: true})
+	app.Post("/orders", makeEndpointHandler(services, ep))
+
+	post := func(body string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+		req.ContentLength = -1
+		req.TransferEncoding = []string{"chunked"}
+		resp, err := app.Test(req, 2000)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status=%d", resp.StatusCode)
+		}
+		if n := <-primarySeen; n != len(body) {
+			t.Fatalf("primary got %d bytes, want %d", n, len(body))
+		}
+	}
+
+	// chunked без длины в пределах лимита копируется по ходу отправки в основной upstream
+	post(`{"id":1}`)
+	select {
+	case got := <-shadowSeen:
+		if got != `{"id":1}` {
+			t.Fatalf("shadow body=%q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("shadow request not sent")
+	}
+
+	// больше лимита: основной upstream получает тело целиком, копия не отправляется
+	post(strings.Repeat("x", 64))
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(logs.String(), "[waiterd][mirror] skip") {
+		if time.Now().After(deadline) {
+			t.Fatalf("oversized mirror not skipped, logs:\n%s", logs.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case got := <-shadowSeen:
+		t.Fatalf("shadow got oversized body %q", got)
+	default:
+	}
+}
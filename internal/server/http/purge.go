@@ -0,0 +1,270 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+// Необязательные возможности драйвера кэша для инвалидации (как cacheLocker для склейки).
+type (
+	cacheDeleter interface {
+		// Delete removes exact keys and returns how many existed.
+		Delete(ctx context.Context, keys ...string) (int, error)
+	}
+	cacheMatcher interface {
+		// DeleteMatch removes keys matching a Redis-style glob (*, ?, [...], \ escapes).
+		DeleteMatch(ctx context.Context, pattern string) (int, error)
+	}
+	cacheTagger interface {
+		// Tag links key to tags for at least ttl.
+		Tag(ctx context.Context, key string, tags []string, ttl time.Duration) error
+		// DeleteTags removes every key linked to any of tags.
+		DeleteTags(ctx context.Context, tags ...string) (int, error)
+	}
+)
+
+var errPurgeUnsupported = errors.New("cache driver does not support this purge")
+
+// cachedMethods — методы, ответы на которые попадают в кэш (первая часть ключа);
+// POST и QUERY — только на endpoint с cache_key.body.
+var cachedMethods = []string{"GET", "HEAD", "POST", methodQuery}
+
+// invalidatePrefix в endpoint.invalidates отличает тег от маршрута.
+const invalidatePrefix = "tag:"
+
+// Служебные теги, которые получает каждая запись кэша endpoint: маршрут и путь запроса.
+// По ним invalidates сбрасывает маршруты через множества тегов, а не обходом всех ключей (SCAN).
+const (
+	routeTagPrefix = "route:"
+	urlTagPrefix   = "url:"
+)
+
+func purgeKeys(ctx context.Context, keys ...string) (int, error) {
+	d, ok := CacheInstance.(cacheDeleter)
+	if !ok {
+		return 0, errPurgeUnsupported
+	}
+	return d.Delete(ctx, keys...)
+}
+
+// purgeMatch удаляет по всем шаблонам, даже если какой-то из них не удался.
+func purgeMatch(ctx context.Context, patterns ...string) (int, error) {
+	m, ok := CacheInstance.(cacheMatcher)
+	if !ok {
+		return 0, errPurgeUnsupported
+	}
+	total := 0
+	var errs []error
+	for _, p := range patterns {
+		n, err := m.DeleteMatch(ctx, p)
+		total += n
+		errs = append(errs, err)
+	}
+	return total, errors.Join(errs...)
+}
+
+func purgeTags(ctx context.Context, tags ...string) (int, error) {
+	t, ok := CacheInstance.(cacheTagger)
+	if !ok {
+		return 0, errPurgeUnsupported
+	}
+	return t.DeleteTags(ctx, tags...)
+}
+
+// urlPatterns — globs ключей ответов по пути запроса (с любым query и суффиксами политики ключа).
+// pathGlob уже экранирован (escapeGlob/routeGlob); prefix=true — все пути, начинающиеся с него.
+func urlPatterns(pathGlob string, prefix bool) []string {
+	var out []string
+	for _, m := range cachedMethods {
+		if prefix {
+			out = append(out, m+":"+pathGlob+"*")
+			continue
+		}
+		out = append(out, m+":"+pathGlob, m+":"+pathGlob+"[?|#]*")
+	}
+	return out
+}
+
+// routeGlob превращает маршрут fiber (/posts/:id, /files/*) в glob пути для urlPatterns.
+// Параметр может совпасть и с несколькими сегментами — при инвалидации лишнее удаление безопасно.
+func routeGlob(route string) string {
+	segs := strings.Split(route, "/")
+	for i, s := range segs {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") || strings.HasPrefix(s, "+") {
+			segs[i] = "*"
+		} else {
+			segs[i] = escapeGlob(s)
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// expandTemplate подставляет {name} из параметров маршрута; ok=false, если параметра нет.
+func expandTemplate(tmpl string, params map[string]string) (string, bool) {
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(tmpl, '{')
+		if open < 0 {
+			b.WriteString(tmpl)
+			return b.String(), true
+		}
+		end := strings.IndexByte(tmpl[open:], '}')
+		if end < 0 {
+			b.WriteString(tmpl)
+			return b.String(), true
+		}
+		v, ok := params[tmpl[open+1:open+end]]
+		if !ok || v == "" {
+			return "", false
+		}
+		b.WriteString(tmpl[:open])
+		b.WriteString(v)
+		tmpl = tmpl[open+end+1:]
+	}
+}
+
+// routeShape — маршрут без имён параметров: /posts/:id и /posts/:postId — один маршрут.
+func routeShape(route string) string {
+	segs := strings.Split(route, "/")
+	for i, s := range segs {
+		switch {
+		case strings.HasPrefix(s, ":"):
+			segs[i] = ":"
+		case strings.HasPrefix(s, "*"), strings.HasPrefix(s, "+"):
+			segs[i] = "*"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// invalidationTag — служебный тег, по которому invalidates сбрасывает target:
+// маршрут с параметрами — все его записи, путь — записи этого пути с любым query.
+func invalidationTag(target string) string {
+	if shape := routeShape(target); shape != target {
+		return routeTagPrefix + shape
+	}
+	return urlTagPrefix + target
+}
+
+// cacheTags — теги ответа endpoint для этого запроса: cache_tags и служебные теги маршрута и пути.
+func cacheTags(c *fiber.Ctx, ep config.Endpoint, params map[string]string) []string {
+	path, _, _ := strings.Cut(c.OriginalURL(), "?")
+	// теги переживают запрос (фоновое обновление), поэтому путь копируется
+	tags := []string{routeTagPrefix + routeShape(ep.Path), urlTagPrefix + strings.Clone(path)}
+	for _, t := range ep.CacheTags {
+		if tag, ok := expandTemplate(t, params); ok {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func tagCached(ctx context.Context, key string, tags []string, ttl time.Duration) {
+	if len(tags) == 0 || ttl <= 0 {
+		return
+	}
+	if t, ok := CacheInstance.(cacheTagger); ok {
+		_ = t.Tag(ctx, key, tags, ttl)
+	}
+}
+
+// invalidateAfterSuccess оборачивает handler изменяющего endpoint: после ответа 2xx
+// удаляет из кэша маршруты и теги из endpoint.invalidates (до отправки ответа клиенту,
+// чтобы следующий GET клиента уже не попал в старый кэш). Маршруты сбрасываются по служебным
+// тегам (cacheTags), поэтому это несколько операций с множествами, а не SCAN всего кэша.
+func invalidateAfterSuccess(ep config.Endpoint, next fiber.Handler) fiber.Handler {
+	if len(ep.Invalidates) == 0 {
+		return next
+	}
+	return func(c *fiber.Ctx) error {
+		err := next(c)
+		status := c.Response().StatusCode()
+		if err != nil || status < 200 || status >= 300 || CacheInstance == nil {
+			return err
+		}
+		logReq := reqLogger(c)
+		params := c.AllParams()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(c.UserContext()), 2*time.Second)
+		defer cancel()
+
+		var tags []string
+		for _, tmpl := range ep.Invalidates {
+			target, ok := expandTemplate(tmpl, params)
+			if !ok {
+				logReq("[waiterd][cache] invalidate %q: unresolved placeholder", tmpl)
+				continue
+			}
+			if tag, isTag := strings.CutPrefix(target, invalidatePrefix); isTag {
+				tags = append(tags, tag)
+			} else {
+				tags = append(tags, invalidationTag(target))
+			}
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+		if total, err := purgeTags(ctx, tags...); err != nil {
+			logReq("[waiterd][cache] invalidate failed (%d entries removed): %v", total, err)
+		} else {
+			logReq("[waiterd][cache] invalidated %d entries", total)
+		}
+		return nil
+	}
+}
+
+// escapeGlob экранирует спецсимволы glob в литеральной части шаблона.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// globRegexp переводит glob Redis в регулярное выражение (для драйвера memory).
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString(`(?s)^`)
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "^") {
+				class = "^" + regexp.QuoteMeta(class[1:])
+			} else {
+				class = regexp.QuoteMeta(class)
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,215 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	cases := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"GET:/posts/*", "GET:/posts/1/comments", true},
+		{"GET:/posts", "GET:/posts?page=2", false},
+		{"GET:/posts[?|#]*", "GET:/posts?page=2", true},
+		{"GET:/posts[?|#]*", "GET:/postsX", false},
+		{`GET:/a\*b`, "GET:/a*b", true},
+		{`GET:/a\*b`, "GET:/axb", false},
+		{"GET:/?", "GET:/x", true},
+		{"GET:/[^a]", "GET:/a", false},
+	}
+	for _, tc := range cases {
+		re, err := globRegexp(tc.pattern)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.pattern, err)
+		}
+		if got := re.MatchString(tc.key); got != tc.want {
+			t.Errorf("%q ~ %q = %v, want %v", tc.pattern, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestCachePurgeAndInvalidation(t *testing.T) {
+	t.Cleanup(func() { CacheInstance = nil })
+	CacheInstance = newMemoryCacheAdapter()
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte(r.Method + " " + r.URL.Path))
+	}))
+	t.Cleanup(srv.Close)
+
+	services := indexServices([]config.Service{{Name: "svc", ProxyURL: srv.URL}})
+	app := fiber.New()
+	registerAdminRoutes(app, config.Admin{Token: "secret"})
+	app.Get("/posts", makeEndpointHandler(services, config.Endpoint{
+		Path: "/posts", CacheTTL: "1m",
+		Backend: &config.Backend{Service: "svc", Path: "/posts"},
+	}))
+	app.Get("/posts/:id", makeEndpointHandler(services, config.Endpoint{
+		Path: "/posts/:id", CacheTTL: "1m", CacheTags: []string{"post:{id}"},
+		Backend: &config.Backend{Service: "svc", Path: "/post"},
+	}))
+	app.Put("/posts/:id", makeEndpointHandler(services, config.Endpoint{
+		Path: "/posts/:id", Invalidates: []string{"/posts", "tag:post:{id}"},
+		Backend: &config.Backend{Service: "svc", Path: "/post"},
+	}))
+
+	do := func(method, path, body string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if strings.HasPrefix(path, "/admin") {
+			req.Header.Set("Authorization", "Bearer secret")
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := app.Test(req, 2000)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		return resp.StatusCode
+	}
+	// cached — true, если GET обслужен из кэша (не дошёл до backend)
+	cached := func(path string) bool {
+		t.Helper()
+		before := hits.Load()
+		do(http.MethodGet, path, "")
+		return hits.Load() == before
+	}
+
+	for _, p := range []string{"/posts", "/posts?page=2", "/posts/1", "/posts/2"} {
+		do(http.MethodGet, p, "")
+	}
+
+	// PUT /posts/1 сбрасывает список и всё с тегом post:1, но не post:2
+	if st := do(http.MethodPut, "/posts/1", "{}"); st != http.StatusOK {
+		t.Fatalf("PUT status=%d", st)
+	}
+	if cached("/posts") || cached("/posts?page=2") || cached("/posts/1") {
+		t.Fatal("PUT must invalidate /posts and tag post:1")
+	}
+	if !cached("/posts/2") {
+		t.Fatal("/posts/2 must stay cached")
+	}
+
+	purge := func(body string) {
+		t.Helper()
+		if st := do(http.MethodPost, "/admin/cache/purge", body); st != http.StatusOK {
+			t.Fatalf("purge %s: status=%d", body, st)
+		}
+	}
+
+	purge(`{"keys":["GET:/posts/2"]}`)
+	if cached("/posts/2") {
+		t.Fatal("purge by key")
+	}
+	purge(`{"tags":["post:2"]}`)
+	if cached("/posts/2") {
+		t.Fatal("purge by tag")
+	}
+	purge(`{"endpoint":"/posts/:id"}`)
+	if cached("/posts/1") || cached("/posts/2") || !cached("/posts") {
+		t.Fatal("purge by endpoint")
+	}
+	purge(`{"prefix":"/po"}`)
+	if cached("/posts") || cached("/posts/1") {
+		t.Fatal("purge by prefix")
+	}
+
+	if st := do(http.MethodPost, "/admin/cache/purge", `{}`); st != http.StatusBadRequest {
+		t.Fatalf("empty purge status=%d", st)
+	}
+}
+
+// tagOnlyCache — драйвер без DeleteMatch: invalidates должен обходиться тегами.
+type tagOnlyCache struct{ m *memoryCacheAdapter }
+
+func (c tagOnlyCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return c.m.Get(ctx, key)
+}
+func (c tagOnlyCache) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	return c.m.Set(ctx, key, data, ttl)
+}
+func (c tagOnlyCache) Tag(ctx context.Context, key string, tags []string, ttl time.Duration) error {
+	return c.m.Tag(ctx, key, tags, ttl)
+}
+func (c tagOnlyCache) DeleteTags(ctx context.Context, tags ...string) (int, error) {
+	return c.m.DeleteTags(ctx, tags...)
+}
+
+func TestInvalidates_PurgesRoutesThroughTags(t *testing.T) {
+	t.Cleanup(func() { CacheInstance = nil })
+	CacheInstance = tagOnlyCache{m: newMemoryCacheAdapter()}
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte(r.URL.Path))
+	}))
+	t.Cleanup(srv.Close)
+
+	services := indexServices([]config.Service{{Name: "svc", ProxyURL: srv.URL}})
+	app := fiber.New()
+	app.Get("/posts", makeEndpointHandler(services, config.Endpoint{
+		Path: "/posts", CacheTTL: "1m", Backend: &config.Backend{Service: "svc", Path: "/posts"},
+	}))
+	app.Get("/posts/:id", makeEndpointHandler(services, config.Endpoint{
+		Path: "/posts/:id", CacheTTL: "1m", Backend: &config.Backend{Service: "svc", Path: "/post"},
+	}))
+	app.Put("/posts/:id", makeEndpointHandler(services, config.Endpoint{
+		Path: "/posts/:id", Invalidates: []string{"/posts/{id}"},
+		Backend: &config.Backend{Service: "svc", Path: "/post"},
+	}))
+	// имя параметра другое — маршрут тот же
+	app.Delete("/posts/:postId", makeEndpointHandler(services, config.Endpoint{
+		Path: "/posts/:postId", Invalidates: []string{"/posts/:postId"},
+		Backend: &config.Backend{Service: "svc", Path: "/post"},
+	}))
+
+	do := func(method, path string) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest(method, path, nil), 2000)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s: status=%v err=%v", method, path, resp.StatusCode, err)
+		}
+	}
+	cached := func(path string) bool {
+		t.Helper()
+		before := hits.Load()
+		do(http.MethodGet, path)
+		return hits.Load() == before
+	}
+	warm := func() {
+		for _, p := range []string{"/posts", "/posts/1", "/posts/1?full=1", "/posts/2"} {
+			do(http.MethodGet, p)
+		}
+	}
+
+	warm()
+	do(http.MethodPut, "/posts/1")
+	if cached("/posts/1") || cached("/posts/1?full=1") {
+		t.Fatal("PUT must invalidate /posts/1 with any query")
+	}
+	if !cached("/posts/2") || !cached("/posts") {
+		t.Fatal("PUT /posts/1 must keep other paths")
+	}
+
+	warm()
+	do(http.MethodDelete, "/posts/3")
+	if cached("/posts/1") || cached("/posts/2") {
+		t.Fatal("route target must invalidate every /posts/:id entry")
+	}
+	if !cached("/posts") {
+		t.Fatal("route target must keep /posts")
+	}
+}
@@ -0,0 +1,261 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisCacheAdapter — cacheInterface поверх Redis (одиночный узел, Sentinel или Cluster).
+// Все ключи (записи, блокировки, теги) лежат под prefix, значения сжимаются codec.
+// Пока Redis недоступен, чтение и запись сразу отвечают промахом/ошибкой без ожидания
+// таймаутов: после сетевой ошибки клиент не трогается redisRetryAfter.
+type redisCacheAdapter struct {
+	rdb       redis.UniversalClient
+	prefix    string
+	codec     cacheCodec
+	downUntil atomic.Int64 // unix nano
+}
+
+func (a *redisCacheAdapter) k(key string) string { return a.prefix + key }
+
+// redisRetryAfter — пауза перед следующей попыткой после сетевой ошибки Redis.
+const redisRetryAfter = 2 * time.Second
+
+var errRedisUnavailable = errors.New("redis unavailable")
+
+func (a *redisCacheAdapter) available() bool {
+	return time.Now().UnixNano() >= a.downUntil.Load()
+}
+
+// observe запоминает сбой Redis; redis.Nil и ошибки из-за отмены/дедлайна самого запроса сбоем не считаются.
+func (a *redisCacheAdapter) observe(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, redis.Nil) || ctx.Err() != nil {
+		return err
+	}
+	if a.downUntil.Swap(time.Now().Add(redisRetryAfter).UnixNano()) < time.Now().UnixNano() {
+		log.Printf("[waiterd][cache] redis error, serving cache misses for %s: %v", redisRetryAfter, err)
+	}
+	return err
+}
+
+func (a *redisCacheAdapter) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if !a.available() {
+		return nil, false, errRedisUnavailable
+	}
+	b, err := a.rdb.Get(ctx, a.k(key)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, false, nil
+		}
+		return nil, false, a.observe(ctx, err)
+	}
+	if b, err = a.codec.decode(b); err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (a *redisCacheAdapter) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	if !a.available() {
+		return errRedisUnavailable
+	}
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return a.observe(ctx, a.rdb.Set(ctx, a.k(key), a.codec.encode(data), ttl).Err())
+}
+
+// GetWithTTL reads the value and its remaining TTL in one round trip.
+func (a *redisCacheAdapter) GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	if !a.available() {
+		return nil, 0, false, errRedisUnavailable
+	}
+	var get *redis.StringCmd
+	var ttl *redis.DurationCmd
+	_, err := a.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		get = p.Get(ctx, a.k(key))
+		ttl = p.PTTL(ctx, a.k(key))
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, 0, false, a.observe(ctx, err)
+	}
+	b, err := get.Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, 0, false, nil
+		}
+		return nil, 0, false, a.observe(ctx, err)
+	}
+	if b, err = a.codec.decode(b); err != nil {
+		return nil, 0, false, err
+	}
+	return b, max(ttl.Val(), 0), true, nil
+}
+
+// unlockScript deletes the lock only if it is still ours (it may have expired and been retaken).
+var unlockScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`)
+
+func (a *redisCacheAdapter) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	if !a.available() {
+		return nil, false, errRedisUnavailable
+	}
+	token := uuid.NewString()
+	key = a.k(key)
+	ok, err := a.rdb.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, a.observe(ctx, err)
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = unlockScript.Run(ctx, a.rdb, []string{key}, token).Err()
+	}, true, nil
+}
+
+func (a *redisCacheAdapter) Locked(ctx context.Context, key string) (bool, error) {
+	if !a.available() {
+		return false, errRedisUnavailable
+	}
+	n, err := a.rdb.Exists(ctx, a.k(key)).Result()
+	return n > 0, a.observe(ctx, err)
+}
+
+func (a *redisCacheAdapter) Delete(ctx context.Context, keys ...string) (int, error) {
+	full := make([]string, len(keys))
+	for i, k := range keys {
+		full[i] = a.k(k)
+	}
+	return a.unlink(ctx, full)
+}
+
+// unlink removes full (prefixed) keys one command per key in a pipeline:
+// in Cluster keys live in different slots.
+func (a *redisCacheAdapter) unlink(ctx context.Context, keys []string) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	cmds, err := a.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, k := range keys {
+			p.Unlink(ctx, k)
+		}
+		return nil
+	})
+	n := 0
+	for _, c := range cmds {
+		if ic, ok := c.(*redis.IntCmd); ok {
+			n += int(ic.Val())
+		}
+	}
+	return n, err
+}
+
+// DeleteMatch walks the keyspace with SCAN (non-blocking for Redis) and unlinks matches.
+// In Cluster every master is scanned.
+func (a *redisCacheAdapter) DeleteMatch(ctx context.Context, pattern string) (int, error) {
+	pattern = escapeGlob(a.prefix) + pattern
+	cc, ok := a.rdb.(*redis.ClusterClient)
+	if !ok {
+		return a.deleteScanned(ctx, a.rdb, pattern)
+	}
+	var mu sync.Mutex
+	total := 0
+	err := cc.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		n, err := a.deleteScanned(ctx, node, pattern)
+		mu.Lock()
+		total += n
+		mu.Unlock()
+		return err
+	})
+	return total, err
+}
+
+func (a *redisCacheAdapter) deleteScanned(ctx context.Context, node redis.Cmdable, pattern string) (int, error) {
+	total := 0
+	iter := node.Scan(ctx, 0, pattern, 500).Iterator()
+	batch := make([]string, 0, 500)
+	flush := func() error {
+		n, err := a.unlink(ctx, batch)
+		total += n
+		batch = batch[:0]
+		return err
+	}
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == cap(batch) {
+			if err := flush(); err != nil {
+				return total, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return total, err
+	}
+	return total, flush()
+}
+
+// tagScript adds the key to the tag set and extends the set TTL so it outlives the key.
+var tagScript = redis.NewScript(`
+redis.call("sadd", KEYS[1], ARGV[1])
+local ttl = redis.call("pttl", KEYS[1])
+if ttl == -1 or ttl < tonumber(ARGV[2]) then
+	redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+func (a *redisCacheAdapter) tagSetKey(tag string) string { return a.k("tag:" + tag) }
+
+// Tag runs the script once per tag: a script may only touch keys of one Cluster slot.
+func (a *redisCacheAdapter) Tag(ctx context.Context, key string, tags []string, ttl time.Duration) error {
+	for _, t := range tags {
+		if err := tagScript.Run(ctx, a.rdb, []string{a.tagSetKey(t)}, a.k(key), ttl.Milliseconds()).Err(); err != nil {
+			return a.observe(ctx, err)
+		}
+	}
+	return nil
+}
+
+func (a *redisCacheAdapter) TagKeys(ctx context.Context, tags ...string) ([]string, error) {
+	var keys []string
+	for _, t := range tags {
+		members, err := a.rdb.SMembers(ctx, a.tagSetKey(t)).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			keys = append(keys, strings.TrimPrefix(m, a.prefix))
+		}
+	}
+	return keys, nil
+}
+
+// DeleteTags сбрасывает все теги, даже если какой-то из них не удался.
+func (a *redisCacheAdapter) DeleteTags(ctx context.Context, tags ...string) (int, error) {
+	total := 0
+	var errs []error
+	for _, t := range tags {
+		keys, err := a.rdb.SMembers(ctx, a.tagSetKey(t)).Result()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		n, err := a.unlink(ctx, append(keys, a.tagSetKey(t)))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		total += n - 1 // сам набор тега не считаем
+	}
+	return total, errors.Join(errs...)
+}
@@ -0,0 +1,123 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"waiterd/internal/config"
+	appcache "waiterd/pkg/cache"
+)
+
+func TestRedisConfig(t *testing.T) {
+	cfg := config.Cache{
+		Host: "r", Port: 6380, Username: "gw", Pass: "p",
+		Addrs: []string{"s1:26379", "s2:26379"}, MasterName: "mymaster",
+		TLSEnabled: true, PoolSize: 20, DialTimeout: "300ms",
+	}
+	rc, err := redisConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.Addr != "r:6380" || rc.Username != "gw" || rc.TLS == nil || rc.PoolSize != 20 || rc.DialTimeout != 300*time.Millisecond {
+		t.Fatalf("config=%+v", rc)
+	}
+
+	r := appcache.NewRedis(rc)
+	t.Cleanup(func() { _ = r.Close() })
+	// Sentinel: *redis.Client с failover-подключением
+	if _, ok := r.Client.(*redis.Client); !ok {
+		t.Fatalf("sentinel client type %T", r.Client)
+	}
+
+	rc.MasterName, rc.Cluster = "", true
+	rc2 := appcache.NewRedis(rc)
+	t.Cleanup(func() { _ = rc2.Close() })
+	if _, ok := rc2.Client.(*redis.ClusterClient); !ok {
+		t.Fatalf("cluster client type %T", rc2.Client)
+	}
+
+	if _, err := redisConfig(config.Cache{TLS: &config.ClientTLS{CAFile: "/nonexistent"}}); err == nil {
+		t.Fatal("expected tls error")
+	}
+}
+
+func TestSetupCache_RedisUnreachable(t *testing.T) {
+	t.Cleanup(func() { CacheInstance = nil })
+
+	// порт 1 закрыт: запуск не падает, кэш работает как промах
+	cleanup, err := SetupCache(config.Cache{Driver: "redis", Host: "127.0.0.1", Port: 1, DialTimeout: "200ms"})
+	if err != nil {
+		t.Fatalf("SetupCache: %v", err)
+	}
+	t.Cleanup(cleanup)
+
+	ctx := context.Background()
+	if _, ok, _ := CacheInstance.Get(ctx, "k"); ok {
+		t.Fatal("unexpected hit")
+	}
+	// после сбоя адаптер не ждёт таймаутов, а сразу отвечает промахом
+	start := time.Now()
+	_, ok, err := CacheInstance.Get(ctx, "k")
+	if ok || !errors.Is(err, errRedisUnavailable) || time.Since(start) > 50*time.Millisecond {
+		t.Fatalf("ok=%v err=%v in %s", ok, err, time.Since(start))
+	}
+	if err := CacheInstance.Set(ctx, "k", []byte("v"), time.Minute); !errors.Is(err, errRedisUnavailable) {
+		t.Fatalf("Set err=%v", err)
+	}
+}
+
+func TestCacheCodec(t *testing.T) {
+	large := []byte(`{"status":200,"body":"` + strings.Repeat("hello ", 500) + `"}`)
+	small := []byte(`{"status":200}`)
+
+	for _, algo := range []string{"gzip", "zstd"} {
+		codec, err := newCacheCodec(algo, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc := codec.encode(large)
+		if len(enc) >= len(large) || !bytes.HasPrefix(enc, []byte(codecMarker)) {
+			t.Fatalf("%s: not compressed (%d -> %d)", algo, len(large), len(enc))
+		}
+		if dec, err := codec.decode(enc); err != nil || !bytes.Equal(dec, large) {
+			t.Fatalf("%s: roundtrip err=%v", algo, err)
+		}
+		if enc := codec.encode(small); !bytes.Equal(enc, small) {
+			t.Fatalf("%s: value below threshold must be stored as is", algo)
+		}
+		// несжатые записи (старые или до включения сжатия) читаются как есть
+		if dec, err := codec.decode(small); err != nil || !bytes.Equal(dec, small) {
+			t.Fatalf("%s: plain decode err=%v", algo, err)
+		}
+	}
+
+	// выключенное сжатие всё равно читает сжатые ранее записи
+	gz, _ := newCacheCodec("gzip", 0)
+	if dec, err := (cacheCodec{}).decode(gz.encode(large)); err != nil || !bytes.Equal(dec, large) {
+		t.Fatalf("decode with compression off: err=%v", err)
+	}
+	if _, err := newCacheCodec("lz4", 0); err == nil {
+		t.Fatal("expected error for unknown compression")
+	}
+}
+
+func TestCacheKeyPrefix(t *testing.T) {
+	t.Setenv("APP_ENV", "staging")
+	cases := map[string]string{
+		"":                   "",
+		"waiterd":            "waiterd:",
+		"gw:{env}:{version}": "gw:staging:v2:",
+		"gw:{env}:":          "gw:staging:",
+	}
+	for tmpl, want := range cases {
+		if got := cacheKeyPrefix(tmpl, "v2"); got != want {
+			t.Errorf("cacheKeyPrefix(%q)=%q, want %q", tmpl, got, want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
@@ -14,16 +15,31 @@ import (
 
 var pathParamRegex = regexp.MustCompile(`\{([a-zA-Z0-9_]+)\}`)
 
+// requestMethods — методы, которые принимает fiber: стандартные и QUERY.
+var requestMethods = append(slices.Clone(fiber.DefaultMethods), methodQuery)
+
 // RegisterRoutes строит маршруты на основе конфигурации.
 func RegisterRoutes(app *fiber.App, cfg *config.FinalConfig) {
 	app.Get("/health", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	// /ready — готовность принимать трафик: 503, пока идёт первый прогрев кэша (cache.warmup)
+	app.Get("/ready", func(c *fiber.Ctx) error {
+		if warmingUp.Load() {
+			return c.Status(http.StatusServiceUnavailable).SendString("warming up")
+		}
+		return c.SendString("ok")
+	})
 	if strings.ToLower(strings.TrimSpace(os.Getenv("APP_ENV"))) == "dev" {
 		app.Get("/debug/config", func(c *fiber.Ctx) error { return c.JSON(cfg) })
 	}
 
 	services := indexServices(cfg.Services)
 
-	for _, ep := range cfg.Endpoints {
+	// endpoint с одинаковыми method+path (но разными match) обслуживаются одним маршрутом
+	type routeKey struct{ method, path string }
+	var keys []routeKey
+	groups := make(map[routeKey][]routeCandidate)
+
+	for i, ep := range cfg.Endpoints {
 		ep := ep // захватываем для замыкания
 
 		if ep.Backend == nil && len(ep.Calls) == 0 {
@@ -36,10 +52,27 @@ func RegisterRoutes(app *fiber.App, cfg *config.FinalConfig) {
 			method = http.MethodGet
 		}
 
-		path := fiberPath(ep.Path)
-		h := makeEndpointHandler(services, ep)
+		k := routeKey{method: method, path: fiberPath(ep.Path)}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], routeCandidate{ep: ep, order: i, handler: makeEndpointHandler(services, ep)})
+		if ep.Backend != nil && ep.Backend.Split != nil && len(ep.Backend.Split.Targets) > 0 {
+			splitStateFor(ep)
+		}
+	}
+
+	if cfg.Gateway.Admin.Token != "" {
+		registerAdminRoutes(app, cfg.Gateway.Admin)
+	}
+
+	for _, k := range keys {
+		method, path := k.method, k.path
+		cands := groups[k]
+		sortRouteCandidates(cands)
+		h := dispatchRoute(cands)
 
-		log.Printf("[waiterd] register endpoint %s %s", method, path)
+		log.Printf("[waiterd] register endpoint %s %s (%d variant(s))", method, path, len(cands))
 		switch method {
 		case http.MethodGet:
 			app.Get(path, h)
@@ -51,6 +84,8 @@ func RegisterRoutes(app *fiber.App, cfg *config.FinalConfig) {
 			app.Patch(path, h)
 		case http.MethodDelete:
 			app.Delete(path, h)
+		case methodQuery:
+			app.Add(methodQuery, path, h)
 		default:
 			log.Printf("[waiterd] unsupported method %q for path %q, skipping", method, path)
 		}
@@ -1,6 +1,7 @@
 package httpserver
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"sync/atomic"
@@ -41,3 +42,96 @@ func TestRegisterRoutes_BackendPathParams(t *testing.T) {
 		t.Fatalf("backend hits=%d want 1", hits)
 	}
 }
+
+func TestRegisterRoutes_MatchConditions(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	t.Cleanup(backend.Close)
+
+	ep := func(path string, m *config.Match, prio int) config.Endpoint {
+		return config.Endpoint{Path: "/data", Method: http.MethodGet, Match: m, Priority: prio, Backend: &config.Backend{Service: "svc", Path: path}}
+	}
+	cfg := &config.FinalConfig{
+		Services: []config.Service{{Name: "svc", ProxyURL: backend.URL}},
+		Endpoints: []config.Endpoint{
+			ep("/default", &config.Match{Host: "api.example.com"}, 0),
+			ep("/v2", &config.Match{Host: "api.example.com", Headers: map[string]string{"X-Api-Version": "2"}}, 0),
+			ep("/beta", &config.Match{Cookies: map[string]string{"beta": "*"}}, 10),
+			ep("/admin", &config.Match{Host: "*.admin.example.com"}, 0),
+			ep("/debug", &config.Match{Query: map[string]string{"debug": "1"}}, 0),
+		},
+	}
+
+	app := fiber.New()
+	RegisterRoutes(app, cfg)
+
+	tests := []struct {
+		name    string
+		host    string
+		headers map[string]string
+		query   string
+		want    string
+		status  int
+	}{
+		{"host match", "api.example.com", nil, "", "/default", http.StatusOK},
+		{"host with port", "API.example.com:8080", nil, "", "/default", http.StatusOK},
+		{"more specific header wins", "api.example.com", map[string]string{"X-Api-Version": "2"}, "", "/v2", http.StatusOK},
+		{"priority beats specificity", "api.example.com", map[string]string{"X-Api-Version": "2", "Cookie": "beta=yes"}, "", "/beta", http.StatusOK},
+		{"wildcard host", "eu.admin.example.com", nil, "", "/admin", http.StatusOK},
+		{"wildcard needs a label", "admin.example.com", nil, "", "", http.StatusNotFound},
+		{"query match", "other.test", nil, "?debug=1", "/debug", http.StatusOK},
+		{"nothing matches", "other.test", nil, "", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/data"+tt.query, nil)
+			req.Host = tt.host
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("err=%v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status=%d want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status == http.StatusOK {
+				if body, _ := io.ReadAll(resp.Body); string(body) != tt.want {
+					t.Fatalf("routed to %q want %q", string(body), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterRoutes_UnmatchedFallsThrough(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	t.Cleanup(backend.Close)
+
+	cfg := &config.FinalConfig{
+		Services: []config.Service{{Name: "svc", ProxyURL: backend.URL}},
+		Endpoints: []config.Endpoint{
+			{Path: "/data", Method: http.MethodGet, Match: &config.Match{Host: "api.example.com"}, Backend: &config.Backend{Service: "svc", Path: "/api"}},
+		},
+	}
+
+	app := fiber.New()
+	RegisterRoutes(app, cfg)
+	app.Get("/data", func(c *fiber.Ctx) error { return c.SendString("fallback") })
+
+	for host, want := range map[string]string{"api.example.com": "/api", "other.test": "fallback"} {
+		req := httptest.NewRequest(http.MethodGet, "/data", nil)
+		req.Host = host
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("err=%v", err)
+		}
+		if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(body) != want {
+			t.Fatalf("host %s: status=%d body=%q want %q", host, resp.StatusCode, body, want)
+		}
+	}
+}
@@ -2,7 +2,12 @@ package httpserver
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -15,6 +20,11 @@ import (
 type Server struct {
 	app *fiber.App
 	cfg *config.FinalConfig
+
+	// baseCtx is the parent of every request context; cancelled once the graceful
+	// shutdown period is over so that upstream calls still in flight don't outlive the gateway.
+	baseCtx    context.Context
+	cancelBase context.CancelFunc
 }
 
 // New builds a Fiber server with common middlewares.
@@ -24,32 +34,107 @@ func New(cfg *config.FinalConfig) *Server {
 		ReadTimeout:  time.Duration(cfg.Gateway.ReadTimeoutSec) * time.Second,
 		WriteTimeout: time.Duration(cfg.Gateway.WriteTimeoutSec) * time.Second,
 		IdleTimeout:  time.Duration(cfg.Gateway.IdleTimeoutSec) * time.Second,
+		// тело запроса не буферизуем целиком — proxyHTTP читает его потоком;
+		// BodyLimit при этом fasthttp не проверяет, его держит bodyLimitMiddleware
+		StreamRequestBody: true,
+		BodyLimit:         cfg.Gateway.BodyLimit,
+		RequestMethods:    requestMethods,
 	})
 
+	DeadlineHeader = cfg.Gateway.DeadlineHeader
+
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+
 	app.Use(recover.New())
 	//app.Use(logger.New())
+	app.Use(bodyLimitMiddleware)
+	app.Use(requestContextMiddleware(baseCtx))
+	app.Use(clientCertMiddleware)
+	app.Use(warmupMiddleware)
 
 	RegisterRoutes(app, cfg)
 
-	return &Server{app: app, cfg: cfg}
+	return &Server{app: app, cfg: cfg, baseCtx: baseCtx, cancelBase: cancelBase}
 }
 
-// Start runs Fiber server and handles graceful shutdown.
+// Start runs Fiber server (HTTPS when gateway.tls is configured) and handles graceful shutdown.
 func (s *Server) Start(ctx context.Context) error {
 	addr := cfgAddress(s.cfg.Gateway.Address)
-	log.Printf("[waiterd] listening on %s", addr)
+	tlsCfg := s.cfg.Gateway.TLS
+
+	// Handler() собирает дерево маршрутов; дальше прогрев и листенер используют его параллельно
+	startWarmup(ctx, s.app.Handler(), s.cfg.Cache.Warmup)
+
+	errCh := make(chan error, 3)
+	var ln net.Listener
+	var h2srv *http.Server
+	if listenerTLSEnabled(tlsCfg) {
+		conf, store, err := buildListenerTLS(tlsCfg)
+		if err != nil {
+			return fmt.Errorf("gateway tls: %w", err)
+		}
+		interval := parseTTL(tlsCfg.ReloadInterval)
+		if interval <= 0 {
+			interval = 30 * time.Second
+		}
+		go store.watch(ctx, interval)
+
+		raw, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		ln = tls.NewListener(raw, conf)
+		if !tlsCfg.DisableHTTP2 {
+			var h2ln net.Listener
+			ln, h2ln = splitALPN(ln, time.Duration(s.cfg.Gateway.ReadTimeoutSec)*time.Second)
+			h2srv = newH2Server(s.app.Handler(), s.cfg.Gateway)
+			go func() {
+				if err := h2srv.Serve(h2ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					errCh <- fmt.Errorf("http/2 listener: %w", err)
+				}
+			}()
+		}
+		log.Printf("[waiterd] listening on %s (tls)", raw.Addr())
+	} else {
+		log.Printf("[waiterd] listening on %s", addr)
+	}
 
 	// start server in a goroutine
-	errCh := make(chan error, 1)
 	go func() {
+		if ln != nil {
+			errCh <- s.app.Listener(ln)
+			return
+		}
 		errCh <- s.app.Listen(addr)
 	}()
 
+	var redirect *http.Server
+	if ln != nil && tlsCfg.RedirectAddress != "" {
+		redirect = newRedirectServer(tlsCfg.RedirectAddress, ln.Addr().String())
+		log.Printf("[waiterd] redirecting http on %s to https", tlsCfg.RedirectAddress)
+		go func() {
+			if err := redirect.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("redirect listener: %w", err)
+			}
+		}()
+	}
+
 	select {
 	case <-ctx.Done():
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.Gateway.ShutdownTimeoutSec)*time.Second)
 		defer cancel()
-		return s.app.ShutdownWithContext(shutdownCtx)
+		closeWebSockets(shutdownCtx)
+		if redirect != nil {
+			_ = redirect.Shutdown(shutdownCtx)
+		}
+		if h2srv != nil {
+			_ = h2srv.Shutdown(shutdownCtx)
+		}
+		err := s.app.ShutdownWithContext(shutdownCtx)
+		// запросы, начатые до остановки, дорабатывают; что не успело за shutdown_timeout_sec — отменяется
+		s.cancelBase()
+		closeGRPCUpstreams()
+		return err
 	case err := <-errCh:
 		return err
 	}
@@ -0,0 +1,151 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"waiterd/internal/config"
+)
+
+// serviceClients keeps one *http.Client per service so connections (and HTTP/2 streams)
+// are reused across requests and aggregate fan-out.
+var serviceClients sync.Map // service name -> *http.Client
+
+// SetupClients builds HTTP clients for all services once at startup.
+// Broken TLS/pool settings fail fast here instead of on the first request.
+func SetupClients(services []config.Service) error {
+	for _, svc := range services {
+		t, err := newServiceTransport(svc)
+		if err != nil {
+			return fmt.Errorf("service %q: %w", svc.Name, err)
+		}
+		serviceClients.Store(svc.Name, &http.Client{Transport: t})
+	}
+	return nil
+}
+
+// clientFor returns the shared HTTP client of a service, building it on first use
+// when SetupClients was not called (tests, services added later).
+func clientFor(svc config.Service) *http.Client {
+	if v, ok := serviceClients.Load(svc.Name); ok {
+		return v.(*http.Client)
+	}
+	t, err := newServiceTransport(svc)
+	if err != nil {
+		log.Printf("[waiterd] service %q: client settings ignored: %v", svc.Name, err)
+		t, _ = newServiceTransport(config.Service{Name: svc.Name, Protocol: svc.Protocol})
+	}
+	v, _ := serviceClients.LoadOrStore(svc.Name, &http.Client{Transport: t})
+	return v.(*http.Client)
+}
+
+func newServiceTransport(svc config.Service) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	var p http.Protocols
+	switch proto := strings.ToLower(strings.TrimSpace(svc.Protocol)); proto {
+	case "http1":
+		p.SetHTTP1(true)
+		t.ForceAttemptHTTP2 = false
+	case "h2":
+		// HTTP/2 через TLS (ALPN), без отката на HTTP/1.1
+		p.SetHTTP2(true)
+	case "h2c":
+		// HTTP/2 без TLS с prior knowledge — для внутренних сервисов
+		p.SetUnencryptedHTTP2(true)
+	default:
+		if proto != "" && proto != "auto" {
+			log.Printf("[waiterd] service %q: unknown protocol %q, using auto", svc.Name, svc.Protocol)
+		}
+		p.SetHTTP1(true)
+		p.SetHTTP2(true)
+	}
+	t.Protocols = &p
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	t.DialContext = dialer.DialContext
+	if socket, _, ok := unixSocketPath(svc.ProxyURL); ok {
+		t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+	}
+
+	cc := svc.Client
+	if cc == nil {
+		return t, nil
+	}
+
+	if cc.MaxIdleConns > 0 {
+		t.MaxIdleConns = cc.MaxIdleConns
+	}
+	if cc.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = cc.MaxIdleConnsPerHost
+	}
+	if cc.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = cc.MaxConnsPerHost
+	}
+	if d := parseTTL(cc.IdleConnTimeout); d > 0 {
+		t.IdleConnTimeout = d
+	}
+	if d := parseTTL(cc.TLSHandshakeTimeout); d > 0 {
+		t.TLSHandshakeTimeout = d
+	}
+	if d := parseTTL(cc.ResponseHeaderTimeout); d > 0 {
+		t.ResponseHeaderTimeout = d
+	}
+	if d := parseTTL(cc.DialTimeout); d > 0 {
+		dialer.Timeout = d
+	}
+	if d := parseTTL(cc.KeepAlive); d > 0 {
+		dialer.KeepAlive = d
+	}
+
+	if cc.TLS != nil {
+		tlsCfg, err := clientTLSConfig(cc.TLS)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig = tlsCfg
+	}
+
+	return t, nil
+}
+
+// clientTLSConfig собирает tls.Config для upstream: CA, клиентский сертификат (mTLS), SNI.
+func clientTLSConfig(c *config.ClientTLS) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file %q: no PEM certificates found", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
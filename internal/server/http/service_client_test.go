@@ -0,0 +1,208 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+func TestServiceClient_H2C(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	backend.Config.Protocols = new(http.Protocols)
+	backend.Config.Protocols.SetHTTP1(true)
+	backend.Config.Protocols.SetUnencryptedHTTP2(true)
+	backend.Start()
+	t.Cleanup(backend.Close)
+
+	for _, tt := range []struct {
+		protocol string
+		want     string
+	}{
+		{"", "HTTP/1.1"},
+		{"http1", "HTTP/1.1"},
+		{"h2c", "HTTP/2.0"},
+	} {
+		name := "proto-" + tt.protocol
+		t.Cleanup(func() { serviceClients.Delete(name) })
+
+		services := map[string]config.Service{
+			name: {Name: name, ProxyURL: backend.URL, Protocol: tt.protocol},
+		}
+		ep := config.Endpoint{Path: "/p", Backend: &config.Backend{Service: name, Path: "/"}}
+
+		app := fiber.New()
+		app.Get("/p", makeEndpointHandler(services, ep))
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/p", nil))
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("protocol=%q err=%v status=%v", tt.protocol, err, resp.StatusCode)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != tt.want {
+			t.Fatalf("protocol=%q upstream saw %q, want %q", tt.protocol, string(body), tt.want)
+		}
+	}
+}
+
+// writeTestCert creates a self-signed certificate (usable as its own CA) and writes PEM files.
+func writeTestCert(t *testing.T, cn string, dnsNames ...string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              dnsNames,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, _ = x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, cn+".crt")
+	keyFile = filepath.Join(dir, cn+".key")
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile, cert
+}
+
+func TestServiceClient_MutualTLS(t *testing.T) {
+	clientCert, clientKey, clientX509 := writeTestCert(t, "gateway")
+
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientX509)
+	backend.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	backend.StartTLS()
+	t.Cleanup(backend.Close)
+
+	caFile := filepath.Join(t.TempDir(), "backend-ca.pem")
+	_ = os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw}), 0o644)
+
+	services := []config.Service{
+		{Name: "mtls-none", ProxyURL: backend.URL},
+		{Name: "mtls-ok", ProxyURL: backend.URL, Client: &config.ServiceClient{
+			MaxIdleConnsPerHost: 4,
+			DialTimeout:         "1s",
+			TLS:                 &config.ClientTLS{CAFile: caFile, CertFile: clientCert, KeyFile: clientKey, ServerName: "example.com"},
+		}},
+	}
+	if err := SetupClients(services); err != nil {
+		t.Fatalf("SetupClients: %v", err)
+	}
+	t.Cleanup(func() {
+		serviceClients.Delete("mtls-none")
+		serviceClients.Delete("mtls-ok")
+	})
+
+	app := fiber.New()
+	for _, svc := range services {
+		svcs := map[string]config.Service{svc.Name: svc}
+		app.Get("/"+svc.Name, makeEndpointHandler(svcs, config.Endpoint{Backend: &config.Backend{Service: svc.Name, Path: "/"}}))
+	}
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/mtls-none", nil))
+	if err != nil || resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("without client TLS: err=%v status=%v, want 502", err, resp.StatusCode)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/mtls-ok", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("with client TLS: err=%v status=%v", err, resp.StatusCode)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "gateway" {
+		t.Fatalf("backend saw client cert %q", string(body))
+	}
+
+	if err := SetupClients([]config.Service{{Name: "bad", Client: &config.ServiceClient{TLS: &config.ClientTLS{CAFile: "/nonexistent"}}}}); err == nil {
+		t.Fatalf("expected SetupClients error for missing ca_file")
+	}
+}
+
+func TestUnixSocketPath(t *testing.T) {
+	tests := []struct {
+		raw, socket, prefix string
+		ok                  bool
+	}{
+		{"unix:///run/svc.sock", "/run/svc.sock", "", true},
+		{"unix:///run/svc.sock:/api/v1", "/run/svc.sock", "/api/v1", true},
+		{"http://127.0.0.1:9000", "", "", false},
+	}
+	for _, tt := range tests {
+		socket, prefix, ok := unixSocketPath(tt.raw)
+		if socket != tt.socket || prefix != tt.prefix || ok != tt.ok {
+			t.Fatalf("unixSocketPath(%q) = %q,%q,%v want %q,%q,%v", tt.raw, socket, prefix, ok, tt.socket, tt.prefix, tt.ok)
+		}
+	}
+}
+
+func TestUnixSocketUpstream_ProxyAndAggregate(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "svc.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	backend := &httptest.Server{Listener: ln, Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	})}}
+	backend.Start()
+	t.Cleanup(backend.Close)
+	t.Cleanup(func() { serviceClients.Delete("sidecar") })
+
+	services := map[string]config.Service{
+		"sidecar": {Name: "sidecar", ProxyURL: "unix://" + sock + ":/api"},
+	}
+
+	app := fiber.New()
+	app.Get("/proxy", makeEndpointHandler(services, config.Endpoint{Backend: &config.Backend{Service: "sidecar", Path: "/info"}}))
+	app.Get("/agg", makeEndpointHandler(services, config.Endpoint{Path: "/agg", Calls: []config.AggCall{{Name: "info", Service: "sidecar", Path: "/info"}}}))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/proxy", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("proxy err=%v status=%v", err, resp.StatusCode)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != `{"path":"/api/info"}` {
+		t.Fatalf("proxy body=%s", body)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/agg", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("aggregate err=%v status=%v", err, resp.StatusCode)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != `{"info":{"path":"/api/info"}}` {
+		t.Fatalf("aggregate body=%s", body)
+	}
+}
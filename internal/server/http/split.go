@@ -0,0 +1,197 @@
+package httpserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"waiterd/internal/config"
+)
+
+// splits holds the live weights of every split backend, keyed by split id.
+// Weights can be changed at runtime through the admin API.
+var splits sync.Map // id -> *splitState
+
+type splitState struct {
+	id      string
+	cfg     config.Split
+	targets atomic.Pointer[[]config.SplitTarget]
+}
+
+// splitID — id split в admin API: split.name или "METHOD path". Endpoint с одним path+method
+// различаются только match, поэтому их условия тоже входят в id: "GET /x [header:X-Beta=1]".
+func splitID(ep config.Endpoint) string {
+	if ep.Backend.Split.Name != "" {
+		return ep.Backend.Split.Name
+	}
+	method := strings.ToUpper(strings.TrimSpace(ep.Method))
+	if method == "" {
+		method = http.MethodGet
+	}
+	id := method + " " + ep.Path
+	if m := matchID(ep.Match); m != "" {
+		id += " [" + m + "]"
+	}
+	return id
+}
+
+// matchID записывает условия match в стабильном порядке.
+func matchID(m *config.Match) string {
+	if m == nil {
+		return ""
+	}
+	var parts []string
+	if m.Host != "" {
+		parts = append(parts, "host="+m.Host)
+	}
+	add := func(kind string, kv map[string]string) {
+		for _, k := range slices.Sorted(maps.Keys(kv)) {
+			parts = append(parts, kind+":"+k+"="+kv[k])
+		}
+	}
+	add("header", m.Headers)
+	add("query", m.Query)
+	add("cookie", m.Cookies)
+	return strings.Join(parts, " ")
+}
+
+// splitStateFor returns the shared state of an endpoint's split, creating it on first use.
+func splitStateFor(ep config.Endpoint) *splitState {
+	id := splitID(ep)
+	if v, ok := splits.Load(id); ok {
+		return v.(*splitState)
+	}
+	st := &splitState{id: id, cfg: *ep.Backend.Split}
+	targets := append([]config.SplitTarget{}, ep.Backend.Split.Targets...)
+	st.targets.Store(&targets)
+	v, loaded := splits.LoadOrStore(id, st)
+	if loaded && !reflect.DeepEqual(v.(*splitState).cfg, st.cfg) {
+		log.Printf("[waiterd] split %q is declared more than once; set backend.split.name to tell them apart", id)
+	}
+	return v.(*splitState)
+}
+
+// setWeights replaces the targets of a split; services must stay within the configured ones.
+func (s *splitState) setWeights(targets []config.SplitTarget) error {
+	known := make(map[string]bool)
+	for _, t := range s.cfg.Targets {
+		known[t.Service] = true
+	}
+	total := 0
+	for _, t := range targets {
+		if !known[t.Service] {
+			return fmt.Errorf("service %q is not a target of split %q", t.Service, s.id)
+		}
+		if t.Weight < 0 {
+			return fmt.Errorf("negative weight for %q", t.Service)
+		}
+		total += t.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("split %q needs a positive total weight", s.id)
+	}
+	cp := append([]config.SplitTarget{}, targets...)
+	s.targets.Store(&cp)
+	return nil
+}
+
+// pick выбирает сервис: принудительно через force_header, иначе по весам —
+// детерминированно по sticky-ключу или случайно, если ключа нет.
+func (s *splitState) pick(c *fiber.Ctx) string {
+	targets := *s.targets.Load()
+
+	if h := s.cfg.ForceHeader; h != "" {
+		if forced := c.Get(h); forced != "" {
+			for _, t := range targets {
+				if t.Service == forced {
+					return forced
+				}
+			}
+		}
+	}
+
+	total := 0
+	for _, t := range targets {
+		total += t.Weight
+	}
+	if total <= 0 {
+		return targets[0].Service
+	}
+
+	var n int
+	if key := s.stickyKey(c); key != "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(s.id + "|" + key))
+		n = int(h.Sum32() % uint32(total))
+	} else {
+		n = rand.IntN(total)
+	}
+	for _, t := range targets {
+		if n < t.Weight {
+			return t.Service
+		}
+		n -= t.Weight
+	}
+	return targets[len(targets)-1].Service
+}
+
+// stickyKey извлекает ключ закрепления. Для cookie без значения выдаёт новый id,
+// чтобы следующие запросы клиента попадали в тот же вариант.
+func (s *splitState) stickyKey(c *fiber.Ctx) string {
+	kind, name, ok := strings.Cut(s.cfg.Sticky, ":")
+	if !ok || name == "" {
+		return ""
+	}
+	switch kind {
+	case "header":
+		return c.Get(name)
+	case "claim":
+		if v, ok := jwtClaims(c)[name]; ok {
+			return fmt.Sprint(v)
+		}
+		return ""
+	case "cookie":
+		if v := c.Cookies(name); v != "" {
+			return v
+		}
+		id := uuid.NewString()
+		c.Cookie(&fiber.Cookie{Name: name, Value: id, Path: "/", HTTPOnly: true, SameSite: fiber.CookieSameSiteLaxMode})
+		return id
+	}
+	return ""
+}
+
+// jwtClaims decodes the payload of a Bearer JWT WITHOUT verifying the signature.
+// Use it only for routing/cache keys, never for authorization decisions.
+func jwtClaims(c *fiber.Ctx) map[string]any {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok {
+		return nil
+	}
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+	return claims
+}
@@ -0,0 +1,168 @@
+package httpserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+func TestRegisterRoutes_WeightedSplit(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	stable, canary := newBackend("stable"), newBackend("canary")
+
+	cfg := &config.FinalConfig{
+		Gateway: config.Gateway{Admin: config.Admin{Token: "secret"}},
+		Services: []config.Service{
+			{Name: "stable", ProxyURL: stable.URL},
+			{Name: "canary", ProxyURL: canary.URL},
+		},
+		Endpoints: []config.Endpoint{{
+			Path:   "/split-test",
+			Method: http.MethodGet,
+			Backend: &config.Backend{Path: "/", Split: &config.Split{
+				Name:        "split-test",
+				Targets:     []config.SplitTarget{{Service: "stable", Weight: 50}, {Service: "canary", Weight: 50}},
+				Sticky:      "header:X-User-Id",
+				ForceHeader: "X-Canary",
+			}},
+		}},
+	}
+	t.Cleanup(func() { splits.Delete("split-test") })
+
+	app := fiber.New()
+	RegisterRoutes(app, cfg)
+
+	get := func(headers map[string]string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/split-test", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// один и тот же пользователь всегда попадает в один вариант
+	seen := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		user := map[string]string{"X-User-Id": "user-" + string(rune('a'+i))}
+		first := get(user)
+		if again := get(user); again != first {
+			t.Fatalf("sticky assignment changed: %q then %q", first, again)
+		}
+		seen[first] = true
+	}
+	if !seen["stable"] || !seen["canary"] {
+		t.Fatalf("expected both variants across users, got %v", seen)
+	}
+
+	if got := get(map[string]string{"X-Canary": "canary", "X-User-Id": "u"}); got != "canary" {
+		t.Fatalf("force header: got %q", got)
+	}
+
+	// admin API: без токена — 401, после смены весов весь трафик идёт в canary
+	req := httptest.NewRequest(http.MethodPut, "/admin/splits", strings.NewReader(`{"id":"split-test","targets":[{"service":"canary","weight":1}]}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if resp, _ := app.Test(req, -1); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("admin without token: status=%d", resp.StatusCode)
+	}
+	req = httptest.NewRequest(http.MethodPut, "/admin/splits", strings.NewReader(`{"id":"split-test","targets":[{"service":"canary","weight":1}]}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer secret")
+	if resp, _ := app.Test(req, -1); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("admin update: status=%d", resp.StatusCode)
+	}
+	for i := 0; i < 10; i++ {
+		if got := get(map[string]string{"X-User-Id": "user-" + string(rune('a'+i))}); got != "canary" {
+			t.Fatalf("after reweight got %q", got)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/admin/splits", strings.NewReader(`{"id":"split-test","targets":[{"service":"other","weight":1}]}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer secret")
+	if resp, _ := app.Test(req, -1); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown service accepted: status=%d", resp.StatusCode)
+	}
+}
+
+func TestRegisterRoutes_SplitPerMatchedEndpoint(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	stable, beta := newBackend("stable"), newBackend("beta")
+
+	cfg := &config.FinalConfig{
+		Services: []config.Service{
+			{Name: "stable", ProxyURL: stable.URL},
+			{Name: "beta", ProxyURL: beta.URL},
+		},
+		Endpoints: []config.Endpoint{
+			{
+				Path:  "/split-matched",
+				Match: &config.Match{Headers: map[string]string{"X-Beta": "1"}},
+				Backend: &config.Backend{Path: "/", Split: &config.Split{
+					Targets: []config.SplitTarget{{Service: "beta", Weight: 1}},
+				}},
+			},
+			{
+				Path: "/split-matched",
+				Backend: &config.Backend{Path: "/", Split: &config.Split{
+					Targets: []config.SplitTarget{{Service: "stable", Weight: 1}},
+				}},
+			},
+		},
+	}
+	t.Cleanup(func() {
+		splits.Delete("GET /split-matched")
+		splits.Delete("GET /split-matched [header:X-Beta=1]")
+	})
+	if a, b := splitID(cfg.Endpoints[0]), splitID(cfg.Endpoints[1]); a == b {
+		t.Fatalf("split ids collide: %q", a)
+	}
+
+	app := fiber.New()
+	RegisterRoutes(app, cfg)
+
+	get := func(headers map[string]string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/split-matched", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	for i := 0; i < 5; i++ {
+		if got := get(map[string]string{"X-Beta": "1"}); got != "beta" {
+			t.Fatalf("matched endpoint got %q, want beta", got)
+		}
+		if got := get(nil); got != "stable" {
+			t.Fatalf("fallback endpoint got %q, want stable", got)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// revalidating dedupes background refreshes per cache key within this process.
+var revalidating sync.Map // cache key -> struct{}
+
+// lookupCached reads an entry and tells whether it is fresh, usable stale or a miss.
+// header (заголовки запроса) нужен для записей с Vary; nil — такие записи считаются промахом.
+func lookupCached(ctx context.Context, key string, w cacheWindows, header func(string) string) (*cachedHTTPResponse, cacheState) {
+	data, ok, err := CacheInstance.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, cacheMiss
+	}
+	entry := decodeCachedResponse(data)
+	if len(entry.VaryOn) > 0 {
+		if header == nil {
+			return nil, cacheMiss
+		}
+		if data, ok, err = CacheInstance.Get(ctx, variantKey(key, entry.VaryOn, header)); err != nil || !ok {
+			return nil, cacheMiss
+		}
+		entry = decodeCachedResponse(data)
+	}
+	return entry, w.classify(entry, time.Now())
+}
+
+func storeCachedResponse(ctx context.Context, key string, entry *cachedHTTPResponse, ttl time.Duration) {
+	if b, err := json.Marshal(entry); err == nil {
+		_ = CacheInstance.Set(ctx, key, b, ttl)
+	}
+}
+
+// revalidateInBackground обновляет запись кэша в фоне (stale-while-revalidate).
+// Одновременно ключ обновляет один запрос в процессе, а при общем кэше с блокировками — в кластере.
+// refresh сам сохраняет результат, если его можно кэшировать.
+func revalidateInBackground(parent context.Context, key string, timeout time.Duration,
+	logf func(string, ...any), refresh func(ctx context.Context) error) {
+	if _, busy := revalidating.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	go func() {
+		defer revalidating.Delete(key)
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), timeout)
+		defer cancel()
+
+		if locker, ok := CacheInstance.(cacheLocker); ok {
+			unlock, got, err := locker.TryLock(ctx, "lock:"+key, timeout)
+			if err == nil && !got {
+				return
+			}
+			if got {
+				defer unlock()
+			}
+		}
+
+		if err := refresh(ctx); err != nil {
+			logf("[waiterd][cache] revalidate key=%s failed: %v", key, err)
+			return
+		}
+		logf("[waiterd][cache] revalidated key=%s", key)
+	}()
+}
@@ -0,0 +1,95 @@
+package httpserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+func TestCache_StaleWhileRevalidateAndIfError(t *testing.T) {
+	t.Cleanup(func() {
+		CacheInstance = nil
+		DefaultCacheTTL = 0
+	})
+	CacheInstance = newMemoryCacheAdapter()
+
+	var version, failing atomic.Int32
+	version.Store(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"v":` + string(rune('0'+version.Load())) + `}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	services := indexServices([]config.Service{{Name: "svc", ProxyURL: srv.URL}})
+	app := fiber.New()
+	app.Get("/swr", makeEndpointHandler(services, config.Endpoint{
+		Path: "/swr", CacheTTL: "50ms", CacheStaleWhileRevalidate: "1m",
+		Backend: &config.Backend{Service: "svc", Path: "/"},
+	}))
+	app.Get("/sie", makeEndpointHandler(services, config.Endpoint{
+		Path: "/sie", CacheTTL: "50ms", CacheStaleIfError: "1m",
+		Backend: &config.Backend{Service: "svc", Path: "/"},
+	}))
+	app.Get("/agg", makeEndpointHandler(services, config.Endpoint{
+		Path: "/agg", CacheTTL: "50ms", CacheStaleIfError: "1m",
+		Calls: []config.AggCall{{Name: "a", Service: "svc", Path: "/"}},
+	}))
+
+	get := func(path string) (string, *http.Response) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil), 2000)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return string(b), resp
+	}
+
+	for _, p := range []string{"/swr", "/sie", "/agg"} {
+		if body, resp := get(p); resp.StatusCode != http.StatusOK || resp.Header.Get(fiber.HeaderWarning) != "" {
+			t.Fatalf("%s first: status=%d body=%q", p, resp.StatusCode, body)
+		}
+	}
+	time.Sleep(80 * time.Millisecond)
+
+	// stale-while-revalidate: старый ответ сразу, новый — после фонового обновления
+	version.Store(2)
+	body, resp := get("/swr")
+	if body != `{"v":1}` || resp.Header.Get(fiber.HeaderWarning) != warningStale || resp.Header.Get(fiber.HeaderAge) == "" {
+		t.Fatalf("swr stale: body=%q warning=%q age=%q", body, resp.Header.Get(fiber.HeaderWarning), resp.Header.Get(fiber.HeaderAge))
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if body, resp = get("/swr"); body == `{"v":2}` && resp.Header.Get(fiber.HeaderWarning) == "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("swr not revalidated, body=%q", body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// stale-if-error: backend отвечает 500 — отдаём последнюю удачную версию
+	failing.Store(1)
+	for _, p := range []string{"/sie", "/agg"} {
+		body, resp := get(p)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get(fiber.HeaderWarning) != warningRevalidateFailed {
+			t.Fatalf("%s stale-if-error: status=%d warning=%q body=%q", p, resp.StatusCode, resp.Header.Get(fiber.HeaderWarning), body)
+		}
+	}
+	if body, _ := get("/sie"); body != `{"v":1}` {
+		t.Fatalf("sie body=%q", body)
+	}
+}
@@ -0,0 +1,181 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// cancelOnClose releases the upstream request context once the body is consumed.
+// fasthttp closes the body stream after it has been written to the client
+// (or the client went away), so the upstream connection never outlives the response.
+type cancelOnClose struct {
+	io.Reader
+	body   io.Closer
+	cancel context.CancelFunc
+}
+
+func (r *cancelOnClose) Close() error {
+	err := r.body.Close()
+	r.cancel()
+	return err
+}
+
+// sendUpstreamStream отдаёт тело upstream потоком. fasthttp пишет его уже после выхода из handler,
+// поэтому контекст запроса освобождается не там, а когда поток закрыт (дописан или клиент ушёл).
+func sendUpstreamStream(c *fiber.Ctx, body *cancelOnClose, size int) error {
+	release := takeRequestRelease(c)
+	upstreamCancel := body.cancel
+	body.cancel = func() {
+		upstreamCancel()
+		release()
+	}
+	return c.SendStream(body, size)
+}
+
+// noWriteDeadline clears the connection write deadline once the body starts flowing.
+// fasthttp arms WriteTimeout right before writing the response, which would cut
+// long-lived SSE/long-poll streams; the first Read happens after that.
+type noWriteDeadline struct {
+	io.Reader
+	conn net.Conn
+	once sync.Once
+}
+
+func (r *noWriteDeadline) Read(p []byte) (int, error) {
+	r.once.Do(func() {
+		if r.conn != nil {
+			_ = r.conn.SetWriteDeadline(time.Time{})
+		}
+	})
+	return r.Reader.Read(p)
+}
+
+// errBodyTooLarge — тело запроса больше BodyLimit.
+var errBodyTooLarge = errors.New("request body too large")
+
+// bodyLimitMiddleware держит BodyLimit при StreamRequestBody: fasthttp тогда не отвергает большие тела сам.
+// Content-Length больше лимита — сразу 413; тело неизвестной длины ограничивают limitedBody и requestBody.
+func bodyLimitMiddleware(c *fiber.Ctx) error {
+	if c.Request().Header.ContentLength() > c.App().Config().BodyLimit {
+		return sendBodyTooLarge(c)
+	}
+	return c.Next()
+}
+
+// sendBodyTooLarge отвечает 413. Тело могло остаться недочитанным в соединении, поэтому оно закрывается.
+func sendBodyTooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return c.Status(http.StatusRequestEntityTooLarge).SendString("request body too large")
+}
+
+// limitedBody отдаёт не больше n байт; если у тела есть ещё данные — errBodyTooLarge.
+// В отличие от io.LimitReader не обрезает тело молча: upstream не получит усечённый запрос.
+type limitedBody struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			return 0, errBodyTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// requestBody — тело запроса целиком, для обработчиков, которым нужен буфер (gRPC, admin).
+// Тело неизвестной длины дочитывается не дальше BodyLimit; известную длину уже проверил bodyLimitMiddleware.
+func requestBody(c *fiber.Ctx) ([]byte, error) {
+	s := c.Context().RequestBodyStream()
+	if s == nil || c.Request().Header.ContentLength() >= 0 {
+		return c.Body(), nil
+	}
+	data, err := io.ReadAll(&limitedBody{r: s, n: int64(c.App().Config().BodyLimit)})
+	if err != nil {
+		return nil, err
+	}
+	c.Request().SetBody(data)
+	return c.Body(), nil
+}
+
+// bufferRequestBody — middleware для маршрутов, которые читают тело через c.Body()/BodyParser.
+func bufferRequestBody(c *fiber.Ctx) error {
+	if _, err := requestBody(c); err != nil {
+		return sendBodyError(c, err)
+	}
+	return c.Next()
+}
+
+// isBodyTooLarge — ошибка превышения лимита тела: своя (limitedBody) или net/http (h2Handler).
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.Is(err, errBodyTooLarge) || errors.As(err, &maxErr)
+}
+
+// sendBodyError — ответ на ошибку чтения тела запроса: 413 при превышении BodyLimit, иначе 400.
+func sendBodyError(c *fiber.Ctx, err error) error {
+	if isBodyTooLarge(err) {
+		return sendBodyTooLarge(c)
+	}
+	c.Context().SetConnectionClose()
+	return c.Status(http.StatusBadRequest).SendString("invalid request body")
+}
+
+// upstreamRequestBody returns the incoming request body as a stream plus its length
+// (-1 when unknown, e.g. chunked uploads; such a stream is cut at BodyLimit with errBodyTooLarge).
+func upstreamRequestBody(c *fiber.Ctx) (io.Reader, int64) {
+	cl := c.Request().Header.ContentLength()
+	if cl == 0 {
+		return http.NoBody, 0
+	}
+	if s := c.Context().RequestBodyStream(); s != nil {
+		if cl < 0 {
+			return &limitedBody{r: s, n: int64(c.App().Config().BodyLimit)}, -1
+		}
+		return s, int64(cl)
+	}
+	b := c.Body()
+	if len(b) == 0 {
+		return http.NoBody, 0
+	}
+	return bytes.NewReader(b), int64(len(b))
+}
+
+// readUpTo reads at most limit bytes from r.
+// complete=false means the body is larger than limit; the bytes read so far are returned
+// and the caller is expected to continue streaming from r.
+func readUpTo(r io.Reader, limit int64) (data []byte, complete bool, err error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if n > limit {
+		return buf.Bytes(), false, nil
+	}
+	return buf.Bytes(), true, nil
+}
+
+func maxCacheableBodySize() int64 {
+	if MaxCacheableBodySize <= 0 {
+		return 1 << 20
+	}
+	return MaxCacheableBodySize
+}
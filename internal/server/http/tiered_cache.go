@@ -0,0 +1,190 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// tieredInvalidationChannel — канал Redis pub/sub, через который экземпляры шлюза
+// сбрасывают друг у друга L1 при перезаписи и purge.
+const tieredInvalidationChannel = "waiterd:cache:invalidate"
+
+// tieredCache (driver: tiered) — маленький кэш в памяти процесса (L1) перед общим Redis (L2).
+// Записи живут в L1 не дольше l1TTL и не дольше, чем в L2; запись и удаление идут в оба уровня,
+// а остальным экземплярам рассылается сообщение, чтобы они выбросили свою копию из L1.
+type tieredCache struct {
+	l1    *memoryCacheAdapter
+	l2    cacheInterface
+	l1TTL time.Duration
+	node  string // id экземпляра: свои сообщения не применяем
+	// publish рассылает инвалидацию другим экземплярам (Redis PUBLISH).
+	publish func(ctx context.Context, inv cacheInvalidation) error
+}
+
+// cacheInvalidation — сообщение о ключах, которые надо выбросить из L1.
+type cacheInvalidation struct {
+	Node     string   `json:"node"`
+	Keys     []string `json:"keys,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// Необязательные возможности L2, которыми пользуется tieredCache.
+type (
+	cacheTTLGetter interface {
+		// GetWithTTL returns the value with its remaining lifetime (0 — unknown/no expiry).
+		GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, bool, error)
+	}
+	cacheTagLister interface {
+		TagKeys(ctx context.Context, tags ...string) ([]string, error)
+	}
+)
+
+func newTieredCache(l1 *memoryCacheAdapter, l2 cacheInterface, l1TTL time.Duration,
+	publish func(context.Context, cacheInvalidation) error) *tieredCache {
+	return &tieredCache{l1: l1, l2: l2, l1TTL: l1TTL, node: uuid.NewString(), publish: publish}
+}
+
+func (t *tieredCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if b, ok, _ := t.l1.Get(ctx, key); ok {
+		return b, true, nil
+	}
+	var (
+		b    []byte
+		left time.Duration
+		ok   bool
+		err  error
+	)
+	if g, isTTL := t.l2.(cacheTTLGetter); isTTL {
+		b, left, ok, err = g.GetWithTTL(ctx, key)
+	} else {
+		b, ok, err = t.l2.Get(ctx, key)
+	}
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	_ = t.l1.Set(ctx, key, b, t.localTTL(left))
+	return b, true, nil
+}
+
+func (t *tieredCache) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	if err := t.l2.Set(ctx, key, data, ttl); err != nil {
+		// L2 не записан — старая копия в L1 могла бы пережить новую версию у соседей
+		_, _ = t.l1.Delete(ctx, key)
+		return err
+	}
+	_ = t.l1.Set(ctx, key, data, t.localTTL(ttl))
+	t.broadcast(ctx, cacheInvalidation{Keys: []string{key}})
+	return nil
+}
+
+// localTTL — срок в L1: не дольше l1TTL и не дольше остатка жизни в L2.
+func (t *tieredCache) localTTL(l2TTL time.Duration) time.Duration {
+	if l2TTL > 0 && l2TTL < t.l1TTL {
+		return l2TTL
+	}
+	return t.l1TTL
+}
+
+func (t *tieredCache) broadcast(ctx context.Context, inv cacheInvalidation) {
+	if t.publish == nil {
+		return
+	}
+	inv.Node = t.node
+	if err := t.publish(ctx, inv); err != nil {
+		log.Printf("[waiterd][cache] L1 invalidation publish failed: %v", err)
+	}
+}
+
+// applyInvalidation выбрасывает из L1 ключи из сообщения другого экземпляра.
+func (t *tieredCache) applyInvalidation(inv cacheInvalidation) {
+	if inv.Node == t.node {
+		return
+	}
+	ctx := context.Background()
+	_, _ = t.l1.Delete(ctx, inv.Keys...)
+	for _, p := range inv.Patterns {
+		_, _ = t.l1.DeleteMatch(ctx, p)
+	}
+}
+
+// listen применяет инвалидации из Redis pub/sub, пока ps не закрыт.
+// Сообщения, пропущенные во время переподключения, устаревают сами через l1_ttl.
+func (t *tieredCache) listen(ps *redis.PubSub) {
+	for msg := range ps.Channel() {
+		var inv cacheInvalidation
+		if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+			continue
+		}
+		t.applyInvalidation(inv)
+	}
+}
+
+func (t *tieredCache) Delete(ctx context.Context, keys ...string) (int, error) {
+	d, ok := t.l2.(cacheDeleter)
+	if !ok {
+		return 0, errPurgeUnsupported
+	}
+	n, err := d.Delete(ctx, keys...)
+	_, _ = t.l1.Delete(ctx, keys...)
+	t.broadcast(ctx, cacheInvalidation{Keys: keys})
+	return n, err
+}
+
+func (t *tieredCache) DeleteMatch(ctx context.Context, pattern string) (int, error) {
+	m, ok := t.l2.(cacheMatcher)
+	if !ok {
+		return 0, errPurgeUnsupported
+	}
+	n, err := m.DeleteMatch(ctx, pattern)
+	_, _ = t.l1.DeleteMatch(ctx, pattern)
+	t.broadcast(ctx, cacheInvalidation{Patterns: []string{pattern}})
+	return n, err
+}
+
+// Tag: теги живут только в L2, L1 чистится по списку ключей тега при DeleteTags.
+func (t *tieredCache) Tag(ctx context.Context, key string, tags []string, ttl time.Duration) error {
+	if tg, ok := t.l2.(cacheTagger); ok {
+		return tg.Tag(ctx, key, tags, ttl)
+	}
+	return nil
+}
+
+func (t *tieredCache) DeleteTags(ctx context.Context, tags ...string) (int, error) {
+	tg, ok := t.l2.(cacheTagger)
+	lister, canList := t.l2.(cacheTagLister)
+	if !ok || !canList {
+		return 0, errPurgeUnsupported
+	}
+	keys, err := lister.TagKeys(ctx, tags...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := tg.DeleteTags(ctx, tags...)
+	_, _ = t.l1.Delete(ctx, keys...)
+	t.broadcast(ctx, cacheInvalidation{Keys: keys})
+	return n, err
+}
+
+func (t *tieredCache) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	l, ok := t.l2.(cacheLocker)
+	if !ok {
+		return func() {}, true, nil
+	}
+	return l.TryLock(ctx, key, ttl)
+}
+
+func (t *tieredCache) Locked(ctx context.Context, key string) (bool, error) {
+	l, ok := t.l2.(cacheLocker)
+	if !ok {
+		return false, nil
+	}
+	return l.Locked(ctx, key)
+}
+
+// Stats — метрики L1.
+func (t *tieredCache) Stats() memoryCacheStats { return t.l1.Stats() }
@@ -0,0 +1,85 @@
+package httpserver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTieredCache_L1InvalidationAcrossNodes(t *testing.T) {
+	ctx := context.Background()
+	l2 := newMemoryCacheAdapter()
+
+	// шина вместо Redis pub/sub: сообщение получают все узлы, включая отправителя
+	var nodes []*tieredCache
+	publish := func(_ context.Context, inv cacheInvalidation) error {
+		for _, n := range nodes {
+			n.applyInvalidation(inv)
+		}
+		return nil
+	}
+	a := newTieredCache(newMemoryCacheAdapter(), l2, time.Minute, publish)
+	b := newTieredCache(newMemoryCacheAdapter(), l2, time.Minute, publish)
+	nodes = append(nodes, a, b)
+
+	get := func(c *tieredCache, key string) string {
+		t.Helper()
+		v, ok, err := c.Get(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return "<miss>"
+		}
+		return string(v)
+	}
+
+	_ = a.Set(ctx, "k", []byte("v1"), time.Minute)
+	if got := get(b, "k"); got != "v1" {
+		t.Fatalf("b got %q", got)
+	}
+	// b отвечает из L1: запись в L2 в обход кэша ему не видна
+	_ = l2.Set(ctx, "k", []byte("direct"), time.Minute)
+	if got := get(b, "k"); got != "v1" {
+		t.Fatalf("b must serve from L1, got %q", got)
+	}
+
+	// перезапись на a сбрасывает L1 у b
+	_ = a.Set(ctx, "k", []byte("v2"), time.Minute)
+	if got := get(b, "k"); got != "v2" {
+		t.Fatalf("after rewrite b got %q", got)
+	}
+
+	// purge по тегу и по шаблону
+	_ = a.Tag(ctx, "k", []string{"t"}, time.Minute)
+	if n, err := a.DeleteTags(ctx, "t"); err != nil || n != 1 {
+		t.Fatalf("DeleteTags n=%d err=%v", n, err)
+	}
+	if got := get(b, "k"); got != "<miss>" {
+		t.Fatalf("after tag purge b got %q", got)
+	}
+	_ = a.Set(ctx, "GET:/x", []byte("x"), time.Minute)
+	get(b, "GET:/x")
+	if _, err := a.DeleteMatch(ctx, "GET:/*"); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(b, "GET:/x"); got != "<miss>" {
+		t.Fatalf("after pattern purge b got %q", got)
+	}
+}
+
+func TestTieredCache_L1TTL(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := newMemoryCacheAdapter(), newMemoryCacheAdapter()
+	c := newTieredCache(l1, l2, 20*time.Millisecond, nil)
+
+	_ = c.Set(ctx, "k", []byte("v1"), time.Minute)
+	_ = l2.Set(ctx, "k", []byte("v2"), time.Minute)
+	if v, _, _ := c.Get(ctx, "k"); string(v) != "v1" {
+		t.Fatalf("got %q, want L1 copy", v)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if v, _, _ := c.Get(ctx, "k"); string(v) != "v2" {
+		t.Fatalf("got %q after l1_ttl, want L2 value", v)
+	}
+}
@@ -0,0 +1,225 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+// ClientCertSubjectHeader carries the verified client certificate subject (mTLS) to upstreams.
+// Any value sent by the client itself is dropped.
+const ClientCertSubjectHeader = "X-Client-Cert-Subject"
+
+// clientCertSubjectLocal is the fiber Locals key with the verified client certificate subject.
+const clientCertSubjectLocal = "tls_client_subject"
+
+func listenerTLSEnabled(c config.ListenerTLS) bool {
+	return c.CertFile != "" || len(c.Certificates) > 0
+}
+
+// certStore держит сертификаты листенера и перечитывает их при изменении файлов.
+type certStore struct {
+	pairs []config.CertKeyPair
+
+	mu     sync.RWMutex
+	certs  []*tls.Certificate
+	mtimes []time.Time
+}
+
+func newCertStore(c config.ListenerTLS) (*certStore, error) {
+	var pairs []config.CertKeyPair
+	if c.CertFile != "" {
+		pairs = append(pairs, config.CertKeyPair{CertFile: c.CertFile, KeyFile: c.KeyFile})
+	}
+	pairs = append(pairs, c.Certificates...)
+
+	s := &certStore{pairs: pairs}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *certStore) load() error {
+	certs := make([]*tls.Certificate, 0, len(s.pairs))
+	mtimes := make([]time.Time, 0, len(s.pairs))
+	for _, p := range s.pairs {
+		cert, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load certificate %q: %w", p.CertFile, err)
+		}
+		certs = append(certs, &cert)
+		mtimes = append(mtimes, certModTime(p))
+	}
+	s.mu.Lock()
+	s.certs, s.mtimes = certs, mtimes
+	s.mu.Unlock()
+	return nil
+}
+
+func certModTime(p config.CertKeyPair) time.Time {
+	var latest time.Time
+	for _, f := range []string{p.CertFile, p.KeyFile} {
+		if fi, err := os.Stat(f); err == nil && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest
+}
+
+func (s *certStore) changed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i, p := range s.pairs {
+		if !certModTime(p).Equal(s.mtimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch перечитывает сертификаты, когда меняются файлы; при ошибке остаются старые.
+func (s *certStore) watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if !s.changed() {
+				continue
+			}
+			if err := s.load(); err != nil {
+				log.Printf("[waiterd][tls] reload failed, keeping previous certificates: %v", err)
+				continue
+			}
+			log.Printf("[waiterd][tls] certificates reloaded")
+		}
+	}
+}
+
+// getCertificate выбирает сертификат по SNI; если ни один не подходит — первый.
+func (s *certStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.certs {
+		if hello.SupportsCertificate(c) == nil {
+			return c, nil
+		}
+	}
+	return s.certs[0], nil
+}
+
+// buildListenerTLS собирает tls.Config листенера из gateway.tls.
+func buildListenerTLS(c config.ListenerTLS) (*tls.Config, *certStore, error) {
+	store, err := newCertStore(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg := &tls.Config{
+		GetCertificate: store.getCertificate,
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	if c.DisableHTTP2 {
+		cfg.NextProtos = []string{"http/1.1"}
+	}
+
+	switch strings.TrimSpace(c.MinVersion) {
+	case "", "1.2":
+	case "1.3":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, nil, fmt.Errorf("unsupported tls min_version %q", c.MinVersion)
+	}
+
+	for _, name := range c.CipherSuites {
+		id, ok := cipherSuiteByName(name)
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, id)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.ClientAuth)) {
+	case "", "none":
+		cfg.ClientAuth = tls.NoClientCert
+	case "request":
+		cfg.ClientAuth = tls.RequestClientCert
+	case "verify_if_given":
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, nil, fmt.Errorf("unsupported tls client_auth %q", c.ClientAuth)
+	}
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read client_ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("client_ca_file %q: no PEM certificates found", c.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+	} else if cfg.ClientAuth >= tls.VerifyClientCertIfGiven {
+		return nil, nil, fmt.Errorf("tls client_auth %q requires client_ca_file", c.ClientAuth)
+	}
+
+	return cfg, store, nil
+}
+
+func cipherSuiteByName(name string) (uint16, bool) {
+	for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if cs.Name == name {
+			return cs.ID, true
+		}
+	}
+	return 0, false
+}
+
+// clientCertMiddleware exposes the verified client certificate subject to handlers (Locals)
+// and to upstreams (ClientCertSubjectHeader), dropping any client-supplied value.
+func clientCertMiddleware(c *fiber.Ctx) error {
+	c.Request().Header.Del(ClientCertSubjectHeader)
+	if st := c.Context().TLSConnectionState(); st != nil && len(st.VerifiedChains) > 0 {
+		subject := st.VerifiedChains[0][0].Subject.String()
+		c.Locals(clientCertSubjectLocal, subject)
+		c.Request().Header.Set(ClientCertSubjectHeader, subject)
+	}
+	return c.Next()
+}
+
+// newRedirectServer отвечает 308 на https:// с тем же хостом и путём.
+func newRedirectServer(addr, httpsAddr string) *http.Server {
+	_, httpsPort, _ := net.SplitHostPort(httpsAddr)
+	return &http.Server{
+		Addr:              addr,
+		ReadHeaderTimeout: 5 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if httpsPort != "" && httpsPort != "443" {
+				host = net.JoinHostPort(host, httpsPort)
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+		}),
+	}
+}
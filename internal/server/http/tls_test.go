@@ -0,0 +1,195 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"waiterd/internal/config"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	return addr
+}
+
+func TestServer_TLSListener(t *testing.T) {
+	aCert, aKey, _ := writeTestCert(t, "a.test", "a.test")
+	bCert, bKey, _ := writeTestCert(t, "b.test", "b.test")
+	clientCert, clientKey, clientX509 := writeTestCert(t, "client")
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get(ClientCertSubjectHeader)))
+	}))
+	t.Cleanup(backend.Close)
+
+	addr, redirectAddr := freeAddr(t), freeAddr(t)
+	cfg := &config.FinalConfig{
+		Gateway: config.Gateway{
+			Address:            addr,
+			ShutdownTimeoutSec: 1,
+			TLS: config.ListenerTLS{
+				CertFile:        aCert,
+				KeyFile:         aKey,
+				Certificates:    []config.CertKeyPair{{CertFile: bCert, KeyFile: bKey}},
+				ClientAuth:      "verify_if_given",
+				ClientCAFile:    clientCert,
+				ReloadInterval:  "20ms",
+				RedirectAddress: redirectAddr,
+			},
+		},
+		Services:  []config.Service{{Name: "svc", ProxyURL: backend.URL}},
+		Endpoints: []config.Endpoint{{Path: "/whoami", Method: http.MethodGet, Backend: &config.Backend{Service: "svc", Path: "/"}}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- New(cfg).Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	dial := func(serverName string, certs ...tls.Certificate) *tls.Conn {
+		t.Helper()
+		var conn *tls.Conn
+		var err error
+		for i := 0; i < 50; i++ {
+			conn, err = tls.Dial("tcp", addr, &tls.Config{ServerName: serverName, InsecureSkipVerify: true, Certificates: certs})
+			if err == nil {
+				return conn
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("tls dial %s: %v", serverName, err)
+		return nil
+	}
+	servedCN := func(serverName string) string {
+		conn := dial(serverName)
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	// SNI picks the matching certificate
+	if cn := servedCN("a.test"); cn != "a.test" {
+		t.Fatalf("SNI a.test served %q", cn)
+	}
+	if cn := servedCN("b.test"); cn != "b.test" {
+		t.Fatalf("SNI b.test served %q", cn)
+	}
+
+	// verified client subject is forwarded, a spoofed header is dropped
+	pair, _ := tls.LoadX509KeyPair(clientCert, clientKey)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{pair}}}}
+	resp, err := client.Get("https://" + addr + "/whoami")
+	if err != nil {
+		t.Fatalf("mtls get: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != clientX509.Subject.String() || resp.Proto != "HTTP/1.1" {
+		t.Fatalf("forwarded subject=%q proto=%s want %q over HTTP/1.1", string(body), resp.Proto, clientX509.Subject.String())
+	}
+
+	// клиент с h2 в ALPN получает HTTP/2; mTLS работает и там
+	h2client := &http.Client{Transport: &http.Transport{
+		ForceAttemptHTTP2: true,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{pair}},
+	}}
+	resp, err = h2client.Get("https://" + addr + "/whoami")
+	if err != nil {
+		t.Fatalf("h2 get: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Proto != "HTTP/2.0" || resp.StatusCode != http.StatusOK || string(body) != clientX509.Subject.String() {
+		t.Fatalf("h2: proto=%s status=%d body=%q", resp.Proto, resp.StatusCode, body)
+	}
+
+	anon := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	req, _ := http.NewRequest(http.MethodGet, "https://"+addr+"/whoami", nil)
+	req.Header.Set(ClientCertSubjectHeader, "CN=admin")
+	resp, err = anon.Do(req)
+	if err != nil {
+		t.Fatalf("anon get: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if len(body) != 0 {
+		t.Fatalf("spoofed subject leaked upstream: %q", string(body))
+	}
+
+	// certificate files replaced on disk are picked up without restart
+	newCert, newKey, newX509 := writeTestCert(t, "a.test", "a.test")
+	for src, dst := range map[string]string{newCert: aCert, newKey: aKey} {
+		data, _ := os.ReadFile(src)
+		_ = os.WriteFile(dst, data, 0o600)
+		future := time.Now().Add(time.Minute)
+		_ = os.Chtimes(dst, future, future)
+	}
+	reloaded := false
+	for i := 0; i < 50 && !reloaded; i++ {
+		time.Sleep(20 * time.Millisecond)
+		conn := dial("a.test")
+		reloaded = conn.ConnectionState().PeerCertificates[0].Equal(newX509)
+		conn.Close()
+	}
+	if !reloaded {
+		t.Fatalf("certificate was not reloaded")
+	}
+
+	// plain HTTP listener redirects to HTTPS
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err = noFollow.Get("http://" + redirectAddr + "/whoami?x=1")
+	if err != nil {
+		t.Fatalf("redirect get: %v", err)
+	}
+	resp.Body.Close()
+	_, port, _ := net.SplitHostPort(addr)
+	if resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Location") != "https://127.0.0.1:"+port+"/whoami?x=1" {
+		t.Fatalf("redirect status=%d location=%q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+func TestBuildListenerTLS_Validation(t *testing.T) {
+	cert, key, _ := writeTestCert(t, "gw", "gw")
+
+	conf, _, err := buildListenerTLS(config.ListenerTLS{CertFile: cert, KeyFile: key, MinVersion: "1.3"})
+	if err != nil || conf.MinVersion != tls.VersionTLS13 {
+		t.Fatalf("min_version 1.3: err=%v conf=%v", err, conf)
+	}
+	if !slices.Equal(conf.NextProtos, []string{"h2", "http/1.1"}) {
+		t.Fatalf("alpn=%q", conf.NextProtos)
+	}
+	conf, _, err = buildListenerTLS(config.ListenerTLS{CertFile: cert, KeyFile: key, DisableHTTP2: true})
+	if err != nil || !slices.Equal(conf.NextProtos, []string{"http/1.1"}) {
+		t.Fatalf("disable_http2: err=%v alpn=%q", err, conf.NextProtos)
+	}
+	conf, _, err = buildListenerTLS(config.ListenerTLS{CertFile: cert, KeyFile: key, CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}})
+	if err != nil || len(conf.CipherSuites) != 1 || conf.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Fatalf("cipher suites: err=%v", err)
+	}
+	for _, bad := range []config.ListenerTLS{
+		{CertFile: cert, KeyFile: key, MinVersion: "1.1"},
+		{CertFile: cert, KeyFile: key, CipherSuites: []string{"NOPE"}},
+		{CertFile: cert, KeyFile: key, ClientAuth: "require"},
+		{CertFile: "/nonexistent", KeyFile: key},
+	} {
+		if _, _, err := buildListenerTLS(bad); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package httpserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+	"golang.org/x/sync/errgroup"
+
+	"waiterd/internal/config"
+)
+
+// warmupHeader помечает внутренние запросы прогрева. Значение — случайный токен процесса,
+// поэтому клиент не может этим заголовком обойти кэш.
+const warmupHeader = "X-Waiterd-Warmup"
+
+const warmupLocal = "waiterd.warmup"
+
+var (
+	warmupToken = uuid.NewString()
+	// warmingUp — идёт первый прогрев кэша: /ready отвечает 503.
+	warmingUp atomic.Bool
+)
+
+// warmupMiddleware отмечает запрос прогрева и убирает заголовок, чтобы он не ушёл в upstream.
+func warmupMiddleware(c *fiber.Ctx) error {
+	if v := c.Get(warmupHeader); v != "" {
+		if subtle.ConstantTimeCompare([]byte(v), []byte(warmupToken)) == 1 {
+			c.Locals(warmupLocal, true)
+		}
+		c.Request().Header.Del(warmupHeader)
+	}
+	return c.Next()
+}
+
+// isWarmup — запрос от прогрева: кэш не читается, а ответ перезаписывает запись,
+// так что периодический прогрев обновляет её до истечения TTL.
+func isWarmup(c *fiber.Ctx) bool {
+	v, _ := c.Locals(warmupLocal).(bool)
+	return v
+}
+
+// warmupTarget — один запрос прогрева.
+type warmupTarget struct {
+	method string
+	host   string
+	uri    string // path?query
+}
+
+func warmupEnabled(cfg config.Warmup) bool {
+	return len(cfg.URLs) > 0 || len(cfg.Paths) > 0 || cfg.File != ""
+}
+
+// startWarmup прогревает кэш в фоне: сразу и затем каждые cfg.Interval, пока ctx не отменён.
+// handler — обработчик fiber; запросы идут через все middleware и маршруты, но без сети.
+// done закрывается, когда прогрев остановлен.
+func startWarmup(ctx context.Context, handler fasthttp.RequestHandler, cfg config.Warmup) (done <-chan struct{}) {
+	stopped := make(chan struct{})
+	if !warmupEnabled(cfg) {
+		close(stopped)
+		return stopped
+	}
+	if CacheInstance == nil {
+		log.Printf("[waiterd][warmup] cache is disabled, skipping warmup")
+		close(stopped)
+		return stopped
+	}
+	warmingUp.Store(true)
+	interval := parseTTL(cfg.Interval)
+	go func() {
+		defer close(stopped)
+		warmCache(ctx, handler, cfg)
+		warmingUp.Store(false)
+		if interval <= 0 {
+			return
+		}
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				warmCache(ctx, handler, cfg)
+			}
+		}
+	}()
+	return stopped
+}
+
+// warmCache выполняет один проход прогрева не более чем в cfg.Concurrency запросов одновременно.
+func warmCache(ctx context.Context, handler fasthttp.RequestHandler, cfg config.Warmup) {
+	targets, err := warmupTargets(cfg)
+	if err != nil {
+		log.Printf("[waiterd][warmup] %v", err)
+	}
+	start := time.Now()
+	var failed atomic.Int32
+	g := new(errgroup.Group)
+	g.SetLimit(max(cfg.Concurrency, 1))
+	for _, t := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			if status := warmOne(handler, t, cfg.Headers); status >= http.StatusBadRequest {
+				failed.Add(1)
+				log.Printf("[waiterd][warmup] %s %s -> %d", t.method, t.uri, status)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+	log.Printf("[waiterd][warmup] %d url(s) in %s, %d failed", len(targets), time.Since(start).Round(time.Millisecond), failed.Load())
+}
+
+func warmOne(handler fasthttp.RequestHandler, t warmupTarget, headers map[string]string) int {
+	var req fasthttp.Request
+	req.Header.SetMethod(t.method)
+	req.SetRequestURI(t.uri)
+	req.Header.SetHost(t.host)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set(warmupHeader, warmupToken)
+
+	var fctx fasthttp.RequestCtx
+	fctx.Init(&req, nil, nil)
+	handler(&fctx)
+	status := fctx.Response.StatusCode()
+	// потоковый ответ (не попавший в кэш) закрывается, чтобы освободить upstream
+	fctx.Response.ResetBody()
+	return status
+}
+
+// warmupTargets собирает urls, paths и file в список запросов.
+// Ошибка в одной строке не мешает остальным: она возвращается вместе с разобранным.
+func warmupTargets(cfg config.Warmup) ([]warmupTarget, error) {
+	var out []warmupTarget
+	var errs []string
+	add := func(line string) {
+		t, err := parseWarmupLine(line)
+		if err != nil {
+			errs = append(errs, err.Error())
+			return
+		}
+		out = append(out, t)
+	}
+
+	for _, u := range cfg.URLs {
+		add(u)
+	}
+	for _, p := range cfg.Paths {
+		method := strings.ToUpper(strings.TrimSpace(p.Method))
+		if method == "" {
+			method = http.MethodGet
+		}
+		for _, path := range expandWarmupPath(p.Path, p.Params) {
+			add(method + " " + path)
+		}
+	}
+	if cfg.File != "" {
+		f, err := os.Open(cfg.File)
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			sc := bufio.NewScanner(f)
+			for sc.Scan() {
+				if line := strings.TrimSpace(sc.Text()); line != "" && !strings.HasPrefix(line, "#") {
+					add(line)
+				}
+			}
+			if err := sc.Err(); err != nil {
+				errs = append(errs, fmt.Sprintf("read %s: %v", cfg.File, err))
+			}
+			_ = f.Close()
+		}
+	}
+
+	if len(errs) > 0 {
+		return out, fmt.Errorf("warmup: %s", strings.Join(errs, "; "))
+	}
+	return out, nil
+}
+
+// parseWarmupLine разбирает "[METHOD ]/path?query" или "[METHOD ]http(s)://host/path?query".
+func parseWarmupLine(line string) (warmupTarget, error) {
+	t := warmupTarget{method: http.MethodGet, host: "localhost"}
+	raw := strings.TrimSpace(line)
+	if method, rest, ok := strings.Cut(raw, " "); ok {
+		t.method, raw = strings.ToUpper(method), strings.TrimSpace(rest)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return t, fmt.Errorf("invalid url %q: %v", line, err)
+	}
+	if u.Host != "" {
+		t.host = u.Host
+	} else if !strings.HasPrefix(raw, "/") {
+		return t, fmt.Errorf("invalid url %q: want /path or absolute url", line)
+	}
+	t.uri = u.RequestURI()
+	return t, nil
+}
+
+// expandWarmupPath подставляет в {name} все сочетания значений params (по порядку имён).
+func expandWarmupPath(path string, params map[string][]string) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	out := []string{path}
+	for _, name := range names {
+		var next []string
+		for _, p := range out {
+			for _, v := range params[name] {
+				next = append(next, strings.ReplaceAll(p, "{"+name+"}", url.PathEscape(v)))
+			}
+		}
+		out = next
+	}
+	return out
+}
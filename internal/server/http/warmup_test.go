@@ -0,0 +1,117 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+func TestWarmupTargets(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "urls.txt")
+	if err := os.WriteFile(file, []byte("# hot pages\n/a?x=1\n\nhttps://api.example.com/b\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	targets, err := warmupTargets(config.Warmup{
+		URLs:  []string{"/posts", "head /posts/1", "nope"},
+		Paths: []config.WarmupPath{{Path: "/u/{id}?lang={lang}", Params: map[string][]string{"id": {"1", "2"}, "lang": {"ru"}}}},
+		File:  file,
+	})
+	if err == nil {
+		t.Fatal("expected error for invalid line")
+	}
+	var got []string
+	for _, tg := range targets {
+		got = append(got, tg.method+" "+tg.host+tg.uri)
+	}
+	want := []string{
+		"GET localhost/posts", "HEAD localhost/posts/1",
+		"GET localhost/u/1?lang=ru", "GET localhost/u/2?lang=ru",
+		"GET localhost/a?x=1", "GET api.example.com/b",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("targets=%q\nwant %q", got, want)
+	}
+}
+
+func TestWarmup_FillsAndRefreshesCache(t *testing.T) {
+	t.Cleanup(func() { CacheInstance = nil })
+	CacheInstance = newMemoryCacheAdapter()
+
+	hits := int32(0)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		atomic.AddInt32(&hits, 1)
+		if r.Header.Get(warmupHeader) != "" {
+			t.Error("warmup header leaked upstream")
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+
+	app := fiber.New()
+	app.Use(warmupMiddleware)
+	RegisterRoutes(app, &config.FinalConfig{
+		Services: []config.Service{{Name: "svc", ProxyURL: srv.URL}},
+		Endpoints: []config.Endpoint{{
+			Path: "/posts/{id}", Method: "GET", CacheTTL: "1m",
+			Backend: &config.Backend{Service: "svc", Path: "/"},
+		}},
+	})
+	ready := func() int {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/ready", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	cfg := config.Warmup{URLs: []string{"/posts/1"}, Interval: "20ms", Concurrency: 2}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := startWarmup(ctx, app.Handler(), cfg)
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("/ready during warmup = %d", code)
+	}
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for ready() != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("/ready never became ok")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// прогретая запись отдаётся из кэша; чужой заголовок прогрева кэш не обходит
+	req := httptest.NewRequest(http.MethodGet, "/posts/1", nil)
+	req.Header.Set(warmupHeader, "guess")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get(XCacheHeader) != "HIT" {
+		t.Fatalf("X-Cache=%q, want HIT", resp.Header.Get(XCacheHeader))
+	}
+
+	// interval перезаписывает свежую запись, не дожидаясь истечения TTL
+	for atomic.LoadInt32(&hits) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("hits=%d: warmup did not repeat", atomic.LoadInt32(&hits))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,267 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+
+	"waiterd/internal/config"
+)
+
+// wsSessions tracks live proxied WebSocket sessions so they can be closed on shutdown.
+var wsSessions sync.Map // *wsSession -> struct{}
+
+type wsSession struct {
+	client   *websocket.Conn
+	upstream *websocket.Conn
+	done     chan struct{} // закрыт, когда pumpWebSocket завершился и оба сокета закрыты
+}
+
+// wsCloseGrace — сколько при остановке шлюза ждать ответного Close от сторон, прежде чем закрыть сокеты.
+var wsCloseGrace = time.Second
+
+// webSocketProxyHandler выполняет Upgrade клиента и прокачивает кадры к backend-сервису по ws/wss.
+// Соединение с upstream устанавливается до ответа клиенту, чтобы ошибка отдавалась обычным 502.
+func webSocketProxyHandler(services map[string]config.Service, ep config.Endpoint) fiber.Handler {
+	idle := parseTTL(ep.WebSocket.IdleTimeout)
+	maxSize := ep.WebSocket.MaxMessageSize
+
+	return func(c *fiber.Ctx) error {
+		logReq := reqLogger(c)
+
+		if !websocket.FastHTTPIsWebSocketUpgrade(c.Context()) {
+			return c.Status(http.StatusUpgradeRequired).SendString("websocket upgrade required")
+		}
+
+		svc, ok := services[ep.Backend.Service]
+		if !ok {
+			return c.Status(http.StatusBadGateway).SendString("unknown backend service")
+		}
+
+		base, err := parseBaseURL(svc.ProxyURL)
+		if err != nil {
+			logReq("[waiterd] invalid proxy_url %q for service %q: %v", svc.ProxyURL, svc.Name, err)
+			return c.Status(http.StatusInternalServerError).SendString("invalid backend url")
+		}
+		target := *base
+		if target.Scheme == "https" {
+			target.Scheme = "wss"
+		} else {
+			target.Scheme = "ws"
+		}
+		target.Path = singleJoinPath(base.Path, ep.Backend.Path)
+		target.RawQuery = rawQueryFromOriginal(c.OriginalURL())
+
+		hdr := forwardHeadersFromFiber(c)
+		if v := c.Get("Origin"); v != "" {
+			hdr.Set("Origin", v)
+		}
+		dialer := websocket.Dialer{
+			HandshakeTimeout: serviceTimeout(svc),
+			Subprotocols:     requestedSubprotocols(c),
+			TLSClientConfig:  wsTLSConfig(svc),
+		}
+		if socket, _, ok := unixSocketPath(svc.ProxyURL); ok {
+			dialer.NetDialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), serviceTimeout(svc))
+		upstream, resp, err := dialer.DialContext(ctx, target.String(), hdr)
+		cancel()
+		if err != nil {
+			status := 0
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			logReq("[waiterd][ws] dial svc=%s target=%s status=%d error: %v", svc.Name, target.String(), status, err)
+			return c.Status(http.StatusBadGateway).SendString("backend unavailable")
+		}
+
+		upgrader := websocket.FastHTTPUpgrader{
+			// Origin проверяет upstream: мы пробрасываем его при dial.
+			CheckOrigin: func(*fasthttp.RequestCtx) bool { return true },
+		}
+		if p := upstream.Subprotocol(); p != "" {
+			upgrader.Subprotocols = []string{p}
+		}
+
+		logReq("[waiterd][ws] upgrade svc=%s target=%s", svc.Name, target.String())
+		err = upgrader.Upgrade(c.Context(), func(client *websocket.Conn) {
+			pumpWebSocket(&wsSession{client: client, upstream: upstream, done: make(chan struct{})}, idle, maxSize)
+		})
+		if err != nil {
+			// upgrader уже записал ответ клиенту
+			_ = upstream.Close()
+			logReq("[waiterd][ws] upgrade error: %v", err)
+		}
+		return nil
+	}
+}
+
+// wsTLSConfigs — tls.Config для wss-upstream; как и HTTP-клиент, строится один раз на сервис.
+var wsTLSConfigs sync.Map // service name -> *tls.Config
+
+// wsTLSConfig — TLS к wss-upstream с client.tls сервиса (CA, mTLS, server_name, insecure_skip_verify),
+// теми же настройками, что и у HTTP-клиента сервиса. nil — настроек нет, TLS по умолчанию.
+func wsTLSConfig(svc config.Service) *tls.Config {
+	if svc.Client == nil || svc.Client.TLS == nil {
+		return nil
+	}
+	if v, ok := wsTLSConfigs.Load(svc.Name); ok {
+		return v.(*tls.Config)
+	}
+	cfg, err := clientTLSConfig(svc.Client.TLS)
+	if err != nil {
+		log.Printf("[waiterd] service %q: websocket client tls ignored: %v", svc.Name, err)
+	}
+	v, _ := wsTLSConfigs.LoadOrStore(svc.Name, cfg)
+	return v.(*tls.Config)
+}
+
+// requestedSubprotocols returns Sec-WebSocket-Protocol values offered by the client.
+func requestedSubprotocols(c *fiber.Ctx) []string {
+	var out []string
+	for _, p := range strings.Split(c.Get("Sec-WebSocket-Protocol"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// pumpWebSocket копирует сообщения в обе стороны, пока одна из сторон не закроется
+// или соединение не простоит idle дольше заданного.
+func pumpWebSocket(s *wsSession, idle time.Duration, maxSize int64) {
+	wsSessions.Store(s, struct{}{})
+	defer close(s.done)
+	defer wsSessions.Delete(s)
+	defer s.client.Close()
+	defer s.upstream.Close()
+
+	if maxSize > 0 {
+		s.client.SetReadLimit(maxSize)
+		s.upstream.SetReadLimit(maxSize)
+	}
+
+	var lastActivity atomic.Int64
+	lastActivity.Store(time.Now().UnixNano())
+
+	errc := make(chan error, 2)
+	copyFrames := func(dst, src *websocket.Conn) {
+		for {
+			mt, data, err := src.ReadMessage()
+			if err != nil {
+				errc <- err
+				return
+			}
+			lastActivity.Store(time.Now().UnixNano())
+			if err := dst.WriteMessage(mt, data); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}
+	go copyFrames(s.upstream, s.client)
+	go copyFrames(s.client, s.upstream)
+
+	var tick <-chan time.Time
+	if idle > 0 {
+		t := time.NewTicker(idle / 2)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	// finish отправляет Close обеим сторонам и ждёт, пока pumps прочитают их ответный Close,
+	// но не дольше wsCloseGrace; сокеты закрывают defer выше.
+	pending := 2
+	finish := func(code int, text string) {
+		s.close(code, text)
+		t := time.NewTimer(wsCloseGrace)
+		defer t.Stop()
+		for ; pending > 0; pending-- {
+			select {
+			case <-errc:
+			case <-t.C:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case err := <-errc:
+			pending--
+			code, text := websocket.CloseNormalClosure, ""
+			var ce *websocket.CloseError
+			if errors.As(err, &ce) {
+				code, text = ce.Code, ce.Text
+			} else if errors.Is(err, websocket.ErrReadLimit) {
+				code = websocket.CloseMessageTooBig
+			}
+			finish(code, text)
+			return
+		case <-tick:
+			if time.Since(time.Unix(0, lastActivity.Load())) >= idle {
+				finish(websocket.CloseNormalClosure, "idle timeout")
+				return
+			}
+		}
+	}
+}
+
+func (s *wsSession) close(code int, text string) {
+	// 1005/1006 нельзя отправлять в кадре Close
+	if code == websocket.CloseNoStatusReceived || code == websocket.CloseAbnormalClosure {
+		code = websocket.CloseNormalClosure
+	}
+	msg := websocket.FormatCloseMessage(code, text)
+	deadline := time.Now().Add(time.Second)
+	_ = s.client.WriteControl(websocket.CloseMessage, msg, deadline)
+	_ = s.upstream.WriteControl(websocket.CloseMessage, msg, deadline)
+}
+
+// closeWebSockets отправляет Close (going away) во все активные сессии — вызывается при остановке шлюза.
+// Ответный Close стороны читают pumps, и сессия закрывается сама; сокеты тех, кто не ответил
+// за wsCloseGrace (или до отмены ctx), закрываются принудительно.
+func closeWebSockets(ctx context.Context) {
+	var sessions []*wsSession
+	wsSessions.Range(func(k, _ any) bool {
+		s := k.(*wsSession)
+		s.close(websocket.CloseGoingAway, "gateway shutdown")
+		sessions = append(sessions, s)
+		return true
+	})
+	if len(sessions) == 0 {
+		return
+	}
+
+	grace := time.NewTimer(wsCloseGrace)
+	defer grace.Stop()
+	for i, s := range sessions {
+		select {
+		case <-s.done:
+			continue
+		case <-grace.C:
+		case <-ctx.Done():
+		}
+		for _, rest := range sessions[i:] {
+			_ = rest.client.Close()
+			_ = rest.upstream.Close()
+		}
+		return
+	}
+}
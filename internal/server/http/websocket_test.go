@@ -0,0 +1,277 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+
+	"waiterd/internal/config"
+)
+
+func TestWebSocketProxy_EchoesFrames(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			_ = conn.WriteMessage(mt, append([]byte("echo:"), data...))
+		}
+	}))
+	t.Cleanup(backend.Close)
+
+	cfg := &config.FinalConfig{
+		Services: []config.Service{{Name: "rt", ProxyURL: backend.URL}},
+		Endpoints: []config.Endpoint{{
+			Path:      "/ws",
+			Method:    http.MethodGet,
+			Backend:   &config.Backend{Service: "rt", Path: "/socket"},
+			WebSocket: &config.WebSocket{MaxMessageSize: 1024},
+		}},
+	}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	RegisterRoutes(app, cfg)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = app.Listener(ln) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	url := "ws://" + ln.Addr().String() + "/ws"
+
+	// upstream rejects the handshake -> gateway answers 502
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp == nil || resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 502 without auth, err=%v resp=%v", err, resp)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer t"}})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	mt, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if mt != websocket.TextMessage || string(data) != "echo:hi" {
+		t.Fatalf("got type=%d data=%q", mt, string(data))
+	}
+
+	// oversized message closes the session with 1009
+	_ = conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 2048)))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Fatalf("expected close 1009, got %v", err)
+	}
+}
+
+// waitNoWebSockets ждёт, пока завершатся сессии (в том числе оставшиеся от других тестов).
+func waitNoWebSockets(t *testing.T) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		n := 0
+		wsSessions.Range(func(_, _ any) bool { n++; return true })
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d websocket session(s) still open", n)
+		}
+	}
+}
+
+func TestWebSocketProxy_ShutdownWaitsForCloseHandshake(t *testing.T) {
+	waitNoWebSockets(t)
+	grace := wsCloseGrace
+	wsCloseGrace = 300 * time.Millisecond
+	t.Cleanup(func() { wsCloseGrace = grace })
+
+	upstreamClose := make(chan int, 2)
+	upgrader := websocket.Upgrader{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				var ce *websocket.CloseError
+				if errors.As(err, &ce) {
+					upstreamClose <- ce.Code
+				}
+				return
+			}
+			_ = conn.WriteMessage(mt, data)
+		}
+	}))
+	t.Cleanup(backend.Close)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	RegisterRoutes(app, &config.FinalConfig{
+		Services: []config.Service{{Name: "rt", ProxyURL: backend.URL}},
+		Endpoints: []config.Endpoint{{
+			Path: "/ws", Method: http.MethodGet,
+			Backend: &config.Backend{Service: "rt", Path: "/"}, WebSocket: &config.WebSocket{},
+		}},
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = app.Listener(ln) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	dial := func() *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/ws", nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, _, err := conn.ReadMessage(); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return conn
+	}
+
+	// клиент отвечает на Close: сессия закрывается сама, без ожидания grace
+	conn := dial()
+	clientClose := make(chan error, 1)
+	go func() {
+		_, _, err := conn.ReadMessage()
+		clientClose <- err
+	}()
+	start := time.Now()
+	closeWebSockets(context.Background())
+	if elapsed := time.Since(start); elapsed >= wsCloseGrace {
+		t.Fatalf("responsive peers: shutdown took %v", elapsed)
+	}
+	if err := <-clientClose; !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("client got %v, want close 1001", err)
+	}
+	if code := <-upstreamClose; code != websocket.CloseGoingAway {
+		t.Fatalf("upstream got close %d, want 1001", code)
+	}
+	waitNoWebSockets(t)
+
+	// клиент молчит: сокеты закрываются после grace, но Close до него всё равно доходит
+	conn = dial()
+	start = time.Now()
+	closeWebSockets(context.Background())
+	if elapsed := time.Since(start); elapsed < wsCloseGrace-50*time.Millisecond || elapsed > wsCloseGrace+time.Second {
+		t.Fatalf("silent client: shutdown took %v, want about %v", elapsed, wsCloseGrace)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("silent client got %v, want close 1001", err)
+	}
+	waitNoWebSockets(t)
+}
+
+func TestWebSocketProxy_WSSUpstreamUsesClientTLS(t *testing.T) {
+	clientCert, clientKey, clientX509 := writeTestCert(t, "gateway")
+
+	upgrader := websocket.Upgrader{}
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = conn.WriteMessage(websocket.TextMessage, append([]byte(r.TLS.PeerCertificates[0].Subject.CommonName+":"), data...))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientX509)
+	backend.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	backend.StartTLS()
+	t.Cleanup(backend.Close)
+
+	caFile := filepath.Join(t.TempDir(), "backend-ca.pem")
+	_ = os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw}), 0o644)
+
+	cfg := &config.FinalConfig{
+		Services: []config.Service{
+			{Name: "wss-none", ProxyURL: backend.URL},
+			{Name: "wss-mtls", ProxyURL: backend.URL, Client: &config.ServiceClient{
+				TLS: &config.ClientTLS{CAFile: caFile, CertFile: clientCert, KeyFile: clientKey, ServerName: "example.com"},
+			}},
+		},
+		Endpoints: []config.Endpoint{
+			{Path: "/none", Method: http.MethodGet, Backend: &config.Backend{Service: "wss-none", Path: "/"}, WebSocket: &config.WebSocket{}},
+			{Path: "/mtls", Method: http.MethodGet, Backend: &config.Backend{Service: "wss-mtls", Path: "/"}, WebSocket: &config.WebSocket{}},
+		},
+	}
+	t.Cleanup(func() {
+		for _, svc := range cfg.Services {
+			wsTLSConfigs.Delete(svc.Name)
+			serviceClients.Delete(svc.Name)
+		}
+	})
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	RegisterRoutes(app, cfg)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = app.Listener(ln) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+	base := "ws://" + ln.Addr().String()
+
+	// без client.tls шлюз не доверяет сертификату upstream и не предъявляет свой
+	if _, resp, err := websocket.DefaultDialer.Dial(base+"/none", nil); err == nil || resp == nil || resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("without client tls: err=%v resp=%v, want 502", err, resp)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(base+"/mtls", nil)
+	if err != nil {
+		t.Fatalf("dial with client tls: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "gateway:hi" {
+		t.Fatalf("read data=%q err=%v, want the upstream to see the gateway certificate", data, err)
+	}
+}
@@ -13,7 +13,7 @@ import (
 )
 
 type Cache struct {
-	rdb        *redis.Client
+	rdb        redis.UniversalClient
 	prefix     string
 	defaultTTL time.Duration
 }
@@ -1,13 +1,37 @@
 package cache
 
-import "waiterd/pkg/cfg"
+import (
+	"crypto/tls"
+	"time"
+
+	"waiterd/pkg/cfg"
+)
 
 type Config struct {
 	Addr       string
+	Username   string // ACL (Redis 6+)
 	Password   string
 	DB         int
 	Prefix     string
 	DefaultTTL int // seconds
+
+	// Addrs — узлы Cluster (seed) или адреса Sentinel; пусто — используется Addr.
+	Addrs   []string
+	Cluster bool
+	// MasterName включает Sentinel: клиент спрашивает у Addrs адрес текущего master.
+	MasterName       string
+	SentinelUsername string
+	SentinelPassword string
+
+	TLS *tls.Config // nil — без TLS
+
+	// Пул и таймауты; 0 — значения go-redis по умолчанию.
+	PoolSize     int
+	MinIdleConns int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	PoolTimeout  time.Duration
 }
 
 func LoadConfigFromEnv() Config {
@@ -9,25 +9,59 @@ import (
 
 type Redis struct {
 	Cfg    Config
-	Client *redis.Client
+	Client redis.UniversalClient
 }
 
-func Init(ctx context.Context, cfg Config) (*Redis, error) {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     cfg.Addr,
-		Password: cfg.Password,
-		DB:       cfg.DB,
-	})
+// NewRedis создаёт клиент без проверки соединения: одиночный узел, Sentinel (MasterName)
+// или Cluster (Cluster=true). go-redis подключается лениво и переподключается сам.
+func NewRedis(cfg Config) *Redis {
+	addrs := cfg.Addrs
+	if len(addrs) == 0 && cfg.Addr != "" {
+		addrs = []string{cfg.Addr}
+	}
+	opts := &redis.UniversalOptions{
+		Addrs:            addrs,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		DB:               cfg.DB,
+		MasterName:       cfg.MasterName,
+		SentinelUsername: cfg.SentinelUsername,
+		SentinelPassword: cfg.SentinelPassword,
+		TLSConfig:        cfg.TLS,
+		PoolSize:         cfg.PoolSize,
+		MinIdleConns:     cfg.MinIdleConns,
+		DialTimeout:      cfg.DialTimeout,
+		ReadTimeout:      cfg.ReadTimeout,
+		WriteTimeout:     cfg.WriteTimeout,
+		PoolTimeout:      cfg.PoolTimeout,
+	}
 
-	pctx, cancel := context.WithTimeout(ctx, 2*time.Second)
-	defer cancel()
+	var rdb redis.UniversalClient
+	switch {
+	case cfg.MasterName != "":
+		rdb = redis.NewFailoverClient(opts.Failover())
+	case cfg.Cluster:
+		rdb = redis.NewClusterClient(opts.Cluster())
+	default:
+		rdb = redis.NewClient(opts.Simple())
+	}
+	return &Redis{Cfg: cfg, Client: rdb}
+}
 
-	if err := rdb.Ping(pctx).Err(); err != nil {
-		_ = rdb.Close()
+// Init — NewRedis + проверка соединения (PING); при ошибке клиент закрывается.
+func Init(ctx context.Context, cfg Config) (*Redis, error) {
+	r := NewRedis(cfg)
+	if err := r.Ping(ctx); err != nil {
+		_ = r.Close()
 		return nil, err
 	}
+	return r, nil
+}
 
-	return &Redis{Cfg: cfg, Client: rdb}, nil
+func (r *Redis) Ping(ctx context.Context) error {
+	pctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return r.Client.Ping(pctx).Err()
 }
 
 func (r *Redis) Close() error {